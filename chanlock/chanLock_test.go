@@ -1,10 +1,14 @@
 package chanlock
 
 import (
+	"context"
 	"log"
 	"runtime"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/daheige/thinkgo/mutexlock"
 )
 
 var count = 1
@@ -41,6 +45,30 @@ func TestChanLock(t *testing.T) {
 	log.Println("count: ", count)
 }
 
+func TestChanLockContext(t *testing.T) {
+	chLock := NewChanLock(mutexlock.WithDebug(time.Second))
+	chLock.Lock()
+	if chLock.TryLock() || chLock.TryLockTimeout(10*time.Millisecond) {
+		t.Fatal("acquired the held lock")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := chLock.LockContext(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled,got: %v", err)
+	}
+
+	chLock.Unlock()
+	if err := chLock.LockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	chLock.Unlock()
+	if stats := chLock.Stats(); stats.Acquired != 2 || stats.FailedTry != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
 /**$ go test -v -test.run TestChanLock
 2019/11/27 21:59:50 current count:  1000
 2019/11/27 21:59:50 count:  1001
@@ -2,33 +2,71 @@
 package chanlock
 
 import (
+	"context"
 	"time"
+
+	"github.com/daheige/thinkgo/mutexlock"
 )
 
-// ChanLock chan lock
+var _ mutexlock.Locker = (*ChanLock)(nil)
+
+// ChanLock chan lock,实现了mutexlock.Locker接口
 type ChanLock struct {
-	ch chan struct{} // 空结构体
+	ch  chan struct{} // 空结构体
+	ins *mutexlock.Instrument
 }
 
 // NewChanLock 实例化一个通道空结构体锁对象
-func NewChanLock() *ChanLock {
+// opts和mutexlock.NewMutexLock一样,可以开启监控指标和调试模式
+func NewChanLock(opts ...mutexlock.Option) *ChanLock {
 	return &ChanLock{
-		ch: make(chan struct{}, 1), // 有缓冲通道
+		ch:  make(chan struct{}, 1), // 有缓冲通道
+		ins: mutexlock.NewInstrument(opts...),
 	}
 }
 
 // Lock 通道枷锁
 func (l *ChanLock) Lock() {
-	l.ch <- struct{}{} // 这里是一个空结构体
+	l.ins.Lock(l.tryLock, l.lock)
 }
 
 // Unlock实现通道解锁
 func (l *ChanLock) Unlock() {
-	<-l.ch
+	l.ins.Unlock(l.unlock)
 }
 
 // TryLock 乐观锁实现
 func (l *ChanLock) TryLock() bool {
+	return l.ins.TryLock(l.tryLock)
+}
+
+// LockContext 阻塞加锁,直到加锁成功或者ctx被取消
+func (l *ChanLock) LockContext(ctx context.Context) error {
+	return l.ins.LockContext(ctx, l.tryLock, l.lockContext)
+}
+
+// TryLockTimeout 指定时间内的乐观锁
+func (l *ChanLock) TryLockTimeout(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return l.LockContext(ctx) == nil
+}
+
+// Stats 返回锁的统计数据,没有开启监控指标和调试模式时返回零值
+func (l *ChanLock) Stats() mutexlock.Stats {
+	return l.ins.Stats()
+}
+
+func (l *ChanLock) lock() {
+	l.ch <- struct{}{} // 这里是一个空结构体
+}
+
+func (l *ChanLock) unlock() {
+	<-l.ch
+}
+
+func (l *ChanLock) tryLock() bool {
 	select {
 	case l.ch <- struct{}{}:
 		return true
@@ -38,13 +76,11 @@ func (l *ChanLock) TryLock() bool {
 	return false
 }
 
-// TryLockTimeout 指定时间内的乐观锁
-func (l *ChanLock) TryLockTimeout(timeout time.Duration) bool {
-	t := time.After(timeout)
+func (l *ChanLock) lockContext(ctx context.Context) error {
 	select {
 	case l.ch <- struct{}{}:
-		return true
-	case <-t:
-		return false // timeout
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
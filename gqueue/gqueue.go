@@ -2,26 +2,63 @@
 // 提交任务到tash chan中，然后不断从chan中取出task执行
 // 结合官方的sync.WaitGroup计数信号等待执行完毕
 // go goroutine非抢占式的,通过runtime.Gosched()让出cpu给其他goroutine
+// 支持以下使用方式:
+// 1. 先通过Add添加任务,再调用Start执行所有的任务
+// 2. 流式执行,先调用Run开始执行,生产者一边Add一边执行,Close表示没有新的任务,Wait等待执行完毕
+// 3. 通过NewTyped创建返回类型为T的任务队列,任务结果按照添加的顺序存放,支持fail-fast
 package gqueue
 
 import (
+	"errors"
 	"runtime"
 	"sync"
+
+	"github.com/daheige/thinkgo/grecover"
+)
+
+var (
+	// ErrQueueFull 调用Run之前添加的任务超过了队列的容量
+	ErrQueueFull = errors.New("task queue is full")
+
+	// ErrQueueClosed 调用Close之后添加任务
+	ErrQueueClosed = errors.New("task queue is closed")
 )
 
 type Queue struct {
 	gNum             int                     // 并发执行任务所需要的goroutine个数
-	taskTotal        int                     // 执行任务的总数
+	taskTotal        int                     // 任务队列的容量
 	tasks            chan func() interface{} // 任务放置在缓冲通道中
 	taskCallback     func(res interface{})   // 每个任务执行后的回调函数
 	finishedCallback func()                  // 所有任务执行完毕后的回调
 	wg               sync.WaitGroup          // 保证goroutine同步执行的信号计数器
+	mu               sync.RWMutex            // 保证Add和Close并发安全
+	started          bool                    // 是否已经开始执行
+	closed           bool                    // 是否已经关闭,不能再添加任务
+	startOnce        sync.Once
+	closeOnce        sync.Once
+	waitOnce         sync.Once
+	resMu            sync.Mutex
+	result           Result // 所有任务的执行结果
 }
 
-// New 创建一个任务队列实例
+// Result 所有任务的执行结果
+type Result struct {
+	Results []interface{} // 任务的返回值,按照执行完毕的顺序存放
+	Errors  []error       // 返回error或者panic的任务错误
+	Dropped int           // 没有添加成功的任务个数
+}
+
+// New 创建一个任务队列实例,number是执行任务的goroutine个数
+// total是任务队列的容量,调用Run之前最多可以添加total个任务,超出的任务会返回ErrQueueFull
+// 调用Run之后,队列满了Add会阻塞等待,直到任务被取出执行
+// total小于1时,容量和number一样,适用于流式执行
 func New(number, total int) *Queue {
+	if number < 1 {
+		number = 1
+	}
+
 	if total < 1 {
-		panic("task total number must gt 1")
+		total = number
 	}
 
 	if number > total {
@@ -35,52 +72,128 @@ func New(number, total int) *Queue {
 	}
 }
 
-// Start 开始执行任务
+// Start 开始执行任务,等待已经添加的任务全部执行完毕,不能再添加新的任务
 func (q *Queue) Start() {
-	defer close(q.tasks) // 任务执行完毕后,关闭通道
+	q.Run()
+	q.Close()
+	q.Wait()
+}
 
-	// 设置计数信号个数
-	q.wg.Add(q.taskTotal)
+// Run 开始执行任务,不会阻塞,执行期间可以继续添加任务
+// 添加完毕后需要调用Close,然后通过Wait等待执行完毕
+func (q *Queue) Run() {
+	q.startOnce.Do(func() {
+		q.mu.Lock()
+		q.started = true
+		q.mu.Unlock()
 
-	// 通过goroutineNumber个goroutine来执行task
-	for i := 0; i < q.gNum; i++ {
-		runtime.Gosched() // 让出cpu给其他goroutine
-		go q.work()       // 对每个任务开启独立goroutine执行
-	}
+		q.wg.Add(q.gNum)
+
+		// 通过goroutineNumber个goroutine来执行task
+		for i := 0; i < q.gNum; i++ {
+			runtime.Gosched() // 让出cpu给其他goroutine
+			go q.work()       // 对每个任务开启独立goroutine执行
+		}
+	})
+}
+
+// Close 关闭任务队列,表示没有新的任务,已经添加的任务会继续执行
+func (q *Queue) Close() {
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		close(q.tasks) // 任务添加完毕后,关闭通道
+		q.mu.Unlock()
+	})
+}
+
+// Wait 等待所有的任务执行完毕,返回所有任务的执行结果
+// 需要先调用Close,否则会一直等待新的任务;如果没有调用Run,会自动开始执行
+func (q *Queue) Wait() Result {
+	q.Run()
 
 	// 等待goroutine执行完毕
 	q.wg.Wait()
 
 	// 当所有的任务执行完毕后回调
-	if q.finishedCallback != nil {
-		q.finishedCallback()
-	}
+	q.waitOnce.Do(func() {
+		if q.finishedCallback != nil {
+			q.finishedCallback()
+		}
+	})
+
+	q.resMu.Lock()
+	defer q.resMu.Unlock()
+
+	return q.result
 }
 
 // work 执行任务
 func (q *Queue) work() {
-	for {
-		// 不断取出任务,直到chan关闭
-		task, ok := <-q.tasks
-		if !ok {
-			break
+	defer q.wg.Done()
+
+	// 不断取出任务,直到chan关闭
+	for task := range q.tasks {
+		res := q.exec(task)
+
+		q.resMu.Lock()
+		if err, ok := res.(error); ok {
+			q.result.Errors = append(q.result.Errors, err)
+		} else {
+			q.result.Results = append(q.result.Results, res)
 		}
 
-		res := task()
+		q.resMu.Unlock()
+
 		// 完成一个task立即回调
 		if q.taskCallback != nil {
 			q.taskCallback(res)
 		}
-
-		q.wg.Done()
 	}
 }
 
-// Add 添加任务
-func (q *Queue) Add(task func() interface{}) {
-	if len(q.tasks) <= q.taskTotal-1 { // 防止缓冲通道个数超出边界个数total
+// exec 执行任务,任务panic时返回*PanicError
+func (q *Queue) exec(task func() interface{}) (res interface{}) {
+	defer func() {
+		if e := recover(); e != nil {
+			res = &PanicError{Value: e, Stack: grecover.CatchStack()}
+		}
+	}()
+
+	return task()
+}
+
+// Add 添加任务,任务返回的error会记录在Result.Errors中
+// 调用Run之前队列满了返回ErrQueueFull,调用Close之后返回ErrQueueClosed
+// 添加失败的任务记录在Result.Dropped中
+func (q *Queue) Add(task func() interface{}) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.drop()
+		return ErrQueueClosed
+	}
+
+	if q.started {
 		q.tasks <- task
+		return nil
 	}
+
+	select {
+	case q.tasks <- task:
+		return nil
+	default:
+		q.drop()
+		return ErrQueueFull
+	}
+}
+
+// drop 记录添加失败的任务
+func (q *Queue) drop() {
+	q.resMu.Lock()
+	q.result.Dropped++
+	q.resMu.Unlock()
 }
 
 // SetTaskCallback 设置单个任务执行后的回调函数
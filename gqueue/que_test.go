@@ -1,7 +1,10 @@
 package gqueue
 
 import (
+	"context"
+	"errors"
 	"log"
+	"sync"
 	"testing"
 )
 
@@ -24,6 +27,124 @@ func TestQue(t *testing.T) {
 
 }
 
+func TestQueueFull(t *testing.T) {
+	q := New(2, 3)
+	for i := 0; i < 5; i++ {
+		err := q.Add(task(i))
+		if i >= 3 && err != ErrQueueFull {
+			t.Fatalf("expected ErrQueueFull,got: %v", err)
+		}
+	}
+
+	q.Start()
+	if err := q.Add(task(5)); err != ErrQueueClosed {
+		t.Fatalf("expected ErrQueueClosed,got: %v", err)
+	}
+
+	res := q.Wait()
+	if len(res.Results) != 3 || res.Dropped != 3 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestQueueStream(t *testing.T) {
+	q := New(4, 0)
+	q.Run()
+
+	errTask := errors.New("task error")
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				n := p*100 + i
+				if err := q.Add(func() interface{} {
+					switch {
+					case n%50 == 0:
+						return errTask
+					case n%99 == 0:
+						panic(n)
+					}
+
+					return n
+				}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(p)
+	}
+
+	wg.Wait()
+	q.Close()
+
+	res := q.Wait()
+	if len(res.Results) != 388 || len(res.Errors) != 12 || res.Dropped != 0 {
+		t.Fatalf("results: %d,errors: %d,dropped: %d", len(res.Results), len(res.Errors), res.Dropped)
+	}
+}
+
+func TestTypedQueue(t *testing.T) {
+	q := NewTyped[int](context.Background(), 4)
+	for i := 0; i < 100; i++ {
+		n := i
+		index, err := q.Add(func(ctx context.Context) (int, error) {
+			if n == 50 {
+				panic("boom")
+			}
+
+			return n * n, nil
+		})
+
+		if err != nil || index != i {
+			t.Fatalf("unexpected index: %d,error: %v", index, err)
+		}
+	}
+
+	res, err := q.Wait()
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Fatalf("expected panic error,got: %v", err)
+	}
+
+	for i, r := range res {
+		if i != 50 && (r.Err != nil || r.Value != i*i) {
+			t.Fatalf("unexpected result %d: %+v", i, r)
+		}
+	}
+
+	if _, err := q.Add(nil); err != ErrQueueClosed {
+		t.Fatalf("expected ErrQueueClosed,got: %v", err)
+	}
+}
+
+func TestTypedQueueFailFast(t *testing.T) {
+	q := NewTyped[string](context.Background(), 2, WithFailFast())
+	errFirst := errors.New("first error")
+	for i := 0; i < 20; i++ {
+		n := i
+		q.Add(func(ctx context.Context) (string, error) {
+			if n == 0 {
+				return "", errFirst
+			}
+
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+	}
+
+	res, err := q.Wait()
+	if err != errFirst || len(res) != 20 {
+		t.Fatalf("unexpected error: %v,results: %d", err, len(res))
+	}
+
+	for _, r := range res[1:] {
+		if r.Err != context.Canceled {
+			t.Fatalf("expected context.Canceled,got: %v", r.Err)
+		}
+	}
+}
+
 func taskCallback(res interface{}) {
 	log.Printf("current task result: %v", res)
 }
@@ -0,0 +1,165 @@
+package gqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/daheige/thinkgo/grecover"
+)
+
+// PanicError 任务panic时返回的错误,Stack是grecover.CatchStack捕获的调用栈
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error 实现error接口
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panic: %v", e.Value)
+}
+
+// TaskResult 单个任务的执行结果
+type TaskResult[T any] struct {
+	Value T     // 任务的返回值
+	Err   error // 任务返回的错误,panic时是*PanicError,fail-fast取消后没有执行的任务是ctx.Err()
+}
+
+// Option 采用func Option功能模式为TypedQueue添加参数
+type Option func(o *option)
+
+type option struct {
+	failFast bool
+}
+
+// WithFailFast 第一个任务返回错误后,取消其他正在执行的任务的ctx,还没有执行的任务不再执行
+func WithFailFast() Option {
+	return func(o *option) {
+		o.failFast = true
+	}
+}
+
+// TypedQueue 返回类型为T的任务队列,任务结果按照添加的顺序存放
+// 创建后就开始执行任务,生产者可以一边Add一边执行,Wait等待所有的任务执行完毕
+type TypedQueue[T any] struct {
+	gNum      int                // 并发执行任务所需要的goroutine个数
+	failFast  bool               // 第一个任务返回错误后,是否取消其他任务
+	ctx       context.Context    // 传递给任务的ctx
+	cancel    context.CancelFunc // 取消任务的ctx
+	tasks     chan typedTask[T]  // 任务放置在缓冲通道中
+	wg        sync.WaitGroup     // 执行任务的goroutine
+	mu        sync.RWMutex       // 保证Add和Close并发安全
+	closed    bool               // 是否已经关闭,不能再添加任务
+	closeOnce sync.Once
+	resMu     sync.Mutex
+	results   []TaskResult[T] // 任务结果,下标是添加任务的顺序
+	err       error           // 第一个返回的错误
+}
+
+// typedTask 任务和添加的顺序
+type typedTask[T any] struct {
+	index int
+	fn    func(ctx context.Context) (T, error)
+}
+
+// NewTyped 创建一个返回类型为T的任务队列,number是执行任务的goroutine个数
+// ctx被取消后,还没有执行的任务不再执行,它们的错误是ctx.Err()
+func NewTyped[T any](ctx context.Context, number int, opts ...Option) *TypedQueue[T] {
+	if number < 1 {
+		number = 1
+	}
+
+	o := &option{}
+	for _, fn := range opts {
+		fn(o)
+	}
+
+	q := &TypedQueue[T]{
+		gNum:     number,
+		failFast: o.failFast,
+		tasks:    make(chan typedTask[T], number),
+	}
+
+	q.ctx, q.cancel = context.WithCancel(ctx)
+	q.wg.Add(number)
+	for i := 0; i < number; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// Add 添加任务,返回任务结果在Wait返回值中的下标
+// 队列满了会阻塞等待,直到任务被取出执行,调用Wait之后返回ErrQueueClosed
+func (q *TypedQueue[T]) Add(fn func(ctx context.Context) (T, error)) (int, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return -1, ErrQueueClosed
+	}
+
+	q.resMu.Lock()
+	index := len(q.results)
+	q.results = append(q.results, TaskResult[T]{})
+	q.resMu.Unlock()
+
+	q.tasks <- typedTask[T]{index: index, fn: fn}
+
+	return index, nil
+}
+
+// Wait 关闭队列并等待所有的任务执行完毕
+// 返回按照添加顺序存放的任务结果,以及第一个返回的错误
+func (q *TypedQueue[T]) Wait() ([]TaskResult[T], error) {
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		close(q.tasks)
+		q.mu.Unlock()
+	})
+
+	q.wg.Wait()
+	q.cancel()
+
+	q.resMu.Lock()
+	defer q.resMu.Unlock()
+
+	return q.results, q.err
+}
+
+// work 执行任务,直到chan关闭
+func (q *TypedQueue[T]) work() {
+	defer q.wg.Done()
+
+	for task := range q.tasks {
+		var res TaskResult[T]
+		if err := q.ctx.Err(); err != nil {
+			res.Err = err
+		} else {
+			res.Value, res.Err = q.exec(task.fn)
+		}
+
+		q.resMu.Lock()
+		q.results[task.index] = res
+		if res.Err != nil && q.err == nil {
+			q.err = res.Err
+			if q.failFast {
+				q.cancel()
+			}
+		}
+
+		q.resMu.Unlock()
+	}
+}
+
+// exec 执行任务,任务panic时返回*PanicError
+func (q *TypedQueue[T]) exec(fn func(ctx context.Context) (T, error)) (v T, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = &PanicError{Value: e, Stack: grecover.CatchStack()}
+		}
+	}()
+
+	return fn(q.ctx)
+}
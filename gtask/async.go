@@ -0,0 +1,251 @@
+package gtask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daheige/thinkgo/grecover"
+)
+
+var (
+	// ErrNoTask 没有需要执行的任务
+	ErrNoTask = errors.New("no task to run")
+
+	// ErrAllFailed Any执行的任务全部失败
+	ErrAllFailed = errors.New("all tasks failed")
+)
+
+// Func 异步执行的任务,ctx被取消后任务应该尽快返回
+type Func func(ctx context.Context) (interface{}, error)
+
+// PanicError 任务panic时的错误,Stack是grecover.CatchStack捕获的调用栈
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error 实现error接口
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task exec panic: %v", e.Value)
+}
+
+// Handle 异步任务的句柄,可以等待任务执行完毕,或者取消任务
+type Handle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+	start  time.Time
+	value  interface{}
+	res    *TaskRes
+}
+
+// Go 在独立携程中运行fn,不会阻塞,返回任务的句柄
+// 任务返回,或者ctx被取消时任务结束,ctx被取消后TaskRes.Err是ctx.Err()
+// fn需要监听ctx.Done()尽快返回,否则fn所在的goroutine会继续运行直到fn返回
+func Go(ctx context.Context, fn Func) *Handle {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &Handle{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		start:  time.Now(),
+		res: &TaskRes{
+			Result: make(chan interface{}, 1),
+		},
+	}
+
+	go func() {
+		var v interface{}
+		var err error
+		defer func() {
+			if e := recover(); e != nil {
+				err = &PanicError{Value: e, Stack: grecover.CatchStack()}
+			}
+
+			h.finish(v, err)
+		}()
+
+		v, err = fn(ctx)
+	}()
+
+	go func() {
+		select {
+		case <-h.done:
+		case <-ctx.Done():
+			h.finish(nil, ctx.Err())
+		}
+	}()
+
+	return h
+}
+
+// finish 设置任务的结果,只有第一次调用有效
+func (h *Handle) finish(v interface{}, err error) {
+	h.once.Do(func() {
+		h.value = v
+		h.res.Err = err
+		h.res.CostTime = time.Since(h.start).Seconds()
+		h.res.Result <- v
+		close(h.res.Result)
+		close(h.done)
+		h.cancel()
+	})
+}
+
+// Done 任务结束后关闭的chan
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Cancel 取消任务,任务的ctx会被取消
+func (h *Handle) Cancel() {
+	h.cancel()
+}
+
+// Wait 等待任务结束,返回任务的返回值和错误
+func (h *Handle) Wait() (interface{}, error) {
+	<-h.done
+	return h.value, h.res.Err
+}
+
+// Result 等待任务结束,返回任务的结果,返回值可以从TaskRes.Result中读取
+func (h *Handle) Result() *TaskRes {
+	<-h.done
+	return h.res
+}
+
+// Group 并发执行一组任务,限制同时执行的任务个数
+type Group struct {
+	limit int
+}
+
+// WithLimit 创建最多同时执行n个任务的Group,n小于1表示不限制
+func WithLimit(n int) *Group {
+	return &Group{limit: n}
+}
+
+// All 并发执行所有的任务,返回按照任务顺序存放的返回值
+// 有任务返回错误时取消其他任务,返回第一个错误
+func All(ctx context.Context, fns ...Func) ([]interface{}, error) {
+	return WithLimit(0).All(ctx, fns...)
+}
+
+// Any 并发执行所有的任务,返回第一个执行成功的任务的返回值,并取消其他任务
+// 所有的任务都执行失败时返回ErrAllFailed,包含最后一个任务的错误
+func Any(ctx context.Context, fns ...Func) (interface{}, error) {
+	return WithLimit(0).Any(ctx, fns...)
+}
+
+// Race 并发执行所有的任务,返回第一个结束的任务的返回值和错误,并取消其他任务
+func Race(ctx context.Context, fns ...Func) (interface{}, error) {
+	return WithLimit(0).Race(ctx, fns...)
+}
+
+// All 并发执行所有的任务,返回按照任务顺序存放的返回值
+// 有任务返回错误时取消其他任务,返回第一个错误
+func (g *Group) All(ctx context.Context, fns ...Func) ([]interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	values := make([]interface{}, len(fns))
+	var err error
+	g.wait(g.start(ctx, fns), func(i int, h *Handle) bool {
+		values[i], err = h.Wait()
+		return err != nil
+	})
+
+	return values, err
+}
+
+// Any 并发执行所有的任务,返回第一个执行成功的任务的返回值,并取消其他任务
+// 所有的任务都执行失败时返回ErrAllFailed,包含最后一个任务的错误
+func (g *Group) Any(ctx context.Context, fns ...Func) (interface{}, error) {
+	if len(fns) == 0 {
+		return nil, ErrNoTask
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var value interface{}
+	var err error
+	g.wait(g.start(ctx, fns), func(i int, h *Handle) bool {
+		value, err = h.Wait()
+		return err == nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAllFailed, err)
+	}
+
+	return value, nil
+}
+
+// Race 并发执行所有的任务,返回第一个结束的任务的返回值和错误,并取消其他任务
+func (g *Group) Race(ctx context.Context, fns ...Func) (interface{}, error) {
+	if len(fns) == 0 {
+		return nil, ErrNoTask
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var value interface{}
+	var err error
+	g.wait(g.start(ctx, fns), func(i int, h *Handle) bool {
+		value, err = h.Wait()
+		return true
+	})
+
+	return value, err
+}
+
+// start 开始执行所有的任务,最多同时执行g.limit个任务
+func (g *Group) start(ctx context.Context, fns []Func) []*Handle {
+	handles := make([]*Handle, len(fns))
+	if g.limit < 1 || g.limit >= len(fns) {
+		for i, fn := range fns {
+			handles[i] = Go(ctx, fn)
+		}
+
+		return handles
+	}
+
+	sem := make(chan struct{}, g.limit)
+	for i, fn := range fns {
+		fn := fn
+		handles[i] = Go(ctx, func(ctx context.Context) (interface{}, error) {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
+			defer func() { <-sem }()
+
+			return fn(ctx)
+		})
+	}
+
+	return handles
+}
+
+// wait 按照结束的顺序等待任务,每个任务结束后调用fn,fn返回true时停止等待
+func (g *Group) wait(handles []*Handle, fn func(i int, h *Handle) bool) {
+	finished := make(chan int, len(handles))
+	for i, h := range handles {
+		go func(i int, h *Handle) {
+			<-h.Done()
+			finished <- i
+		}(i, h)
+	}
+
+	for range handles {
+		i := <-finished
+		if fn(i, handles[i]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package gtask
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/daheige/thinkgo/grecover"
+)
+
+// sweepSize 缓存的key个数超过sweepSize时,清除过期的缓存
+const sweepSize = 1024
+
+// Flight 合并相同key的并发调用,同一时间相同key只执行一次fn,所有调用方共享返回值和错误
+// 适用于缓存失效时,多个goroutine同时加载同一个热点key
+type Flight struct {
+	mu    sync.Mutex
+	calls map[string]*call   // 正在执行的调用
+	cache map[string]*cached // 执行成功的结果缓存
+	ttl   time.Duration      // 结果缓存时间,0表示不缓存
+}
+
+// call 正在执行的调用
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// cached 缓存的结果
+type cached struct {
+	value    interface{}
+	expireAt time.Time
+}
+
+// FlightOption 采用func Option功能模式为Flight添加参数
+type FlightOption func(f *Flight)
+
+// WithTTL 执行成功的结果缓存d时间,缓存期间相同key的调用直接返回缓存的结果
+func WithTTL(d time.Duration) FlightOption {
+	return func(f *Flight) {
+		f.ttl = d
+	}
+}
+
+// NewFlight 创建合并相同key并发调用的执行器
+func NewFlight(opts ...FlightOption) *Flight {
+	f := &Flight{
+		calls: make(map[string]*call),
+		cache: make(map[string]*cached),
+	}
+
+	for _, o := range opts {
+		o(f)
+	}
+
+	return f
+}
+
+// Do 执行key对应的fn,如果相同key的fn正在执行,等待它执行完毕并返回它的结果
+// fn panic时返回*PanicError
+func (f *Flight) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	c, v, ok := f.start(key, fn)
+	if ok {
+		return v, nil
+	}
+
+	<-c.done
+	return c.value, c.err
+}
+
+// DoContext 和Do一样,但是ctx被取消后不再等待,返回ctx.Err()
+// 正在执行的fn不会被取消,其他调用方仍然可以获得它的结果
+func (f *Flight) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	c, v, ok := f.start(key, fn)
+	if ok {
+		return v, nil
+	}
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Forget 删除key的缓存,正在执行的调用结束后不会缓存结果
+// 之后相同key的调用会重新执行fn,不再等待正在执行的调用
+func (f *Flight) Forget(key string) {
+	f.mu.Lock()
+	delete(f.calls, key)
+	delete(f.cache, key)
+	f.mu.Unlock()
+}
+
+// start 返回key缓存的结果,或者正在执行的调用,没有正在执行的调用时开始执行fn
+func (f *Flight) start(key string, fn func() (interface{}, error)) (*call, interface{}, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r, ok := f.cache[key]; ok {
+		if time.Now().Before(r.expireAt) {
+			return nil, r.value, true
+		}
+
+		delete(f.cache, key)
+	}
+
+	if c, ok := f.calls[key]; ok {
+		return c, nil, false
+	}
+
+	c := &call{done: make(chan struct{})}
+	f.calls[key] = c
+	go f.exec(key, c, fn)
+
+	return c, nil, false
+}
+
+// exec 执行fn,执行完毕后通知所有等待的调用方
+func (f *Flight) exec(key string, c *call, fn func() (interface{}, error)) {
+	defer func() {
+		if e := recover(); e != nil {
+			c.err = &PanicError{Value: e, Stack: grecover.CatchStack()}
+		}
+
+		f.mu.Lock()
+		// Forget之后,key可能已经是新的调用
+		if f.calls[key] == c {
+			delete(f.calls, key)
+			if c.err == nil && f.ttl > 0 {
+				f.sweep()
+				f.cache[key] = &cached{value: c.value, expireAt: time.Now().Add(f.ttl)}
+			}
+		}
+
+		f.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.err = fn()
+}
+
+// sweep 缓存的key太多时,清除过期的缓存,调用之前需要持有f.mu
+func (f *Flight) sweep() {
+	if len(f.cache) < sweepSize {
+		return
+	}
+
+	now := time.Now()
+	for key, r := range f.cache {
+		if !now.Before(r.expireAt) {
+			delete(f.cache, key)
+		}
+	}
+}
@@ -5,11 +5,12 @@ package gtask
 import (
 	"context"
 	"errors"
-	"fmt"
-	"log"
 	"time"
 )
 
+// ErrTaskTimeout 任务执行超时
+var ErrTaskTimeout = errors.New("task timeout")
+
 //  TaskRes task返回的结果
 type TaskRes struct {
 	Err      error
@@ -17,202 +18,57 @@ type TaskRes struct {
 	CostTime float64
 }
 
-// DoTask 在独立携程中运行fn
+// DoTask 在独立携程中运行fn,等待fn执行完毕
 // 这里返回结果设计为interface{},因为有时候返回结果可以是error
 func DoTask(fn func() interface{}) *TaskRes {
-	t := time.Now()
-	done := make(chan struct{}, 1)
-	res := &TaskRes{
-		Result: make(chan interface{}, 1),
-	}
-
-	go func() {
-		defer func() {
-			close(res.Result)
-			close(done)
-			if err := recover(); err != nil {
-				log.Println("task exec panic error: ", err)
-				res.Err = fmt.Errorf("%v", err)
-			}
-		}()
-
-		r := fn()
-		res.Result <- r
-	}()
-
-	<-done
-
-	res.CostTime = time.Since(t).Seconds()
-	return res
+	return Go(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return fn(), nil
+	}).Result()
 }
 
 // DoTaskWithArgs 在独立携程中执行有参数的fn
 func DoTaskWithArgs(fn func(args ...interface{}) interface{}, args ...interface{}) *TaskRes {
-	t := time.Now()
-	done := make(chan struct{}, 1)
-	res := &TaskRes{
-		Result: make(chan interface{}, 1),
-	}
-
-	go func() {
-		defer func() {
-			close(res.Result)
-			close(done)
-			if err := recover(); err != nil {
-				log.Println("task exec panic error: ", err)
-				res.Err = fmt.Errorf("%v", err)
-			}
-		}()
-
-		r := fn(args...)
-		res.Result <- r
-	}()
-
-	<-done
-
-	res.CostTime = time.Since(t).Seconds()
-	return res
+	return DoTask(func() interface{} {
+		return fn(args...)
+	})
 }
 
-// DoTaskWithTimeout 采用done+select+time.After实现goroutine超时调用
+// DoTaskWithTimeout 在独立携程中执行fn,超时后返回ErrTaskTimeout
+// 超时后fn所在的goroutine会继续运行直到fn返回,需要取消的任务使用Go
 func DoTaskWithTimeout(fn func() interface{}, timeout time.Duration) *TaskRes {
-	t := time.Now()
-	done := make(chan struct{}, 1)
-	res := &TaskRes{
-		Result: make(chan interface{}, 1),
-	}
-
-	go func() {
-		defer func() {
-			close(res.Result)
-			close(done)
-			if err := recover(); err != nil {
-				res.Err = fmt.Errorf("%v", err)
-			}
-		}()
-
-		r := fn()
-		res.Result <- r
-	}()
-
-	select {
-	case <-done:
-		log.Println("task has done")
-	case <-time.After(timeout):
-		if res.Err == nil { // 当执行过程中没有发生了panic的话，这里设置为任务超时错误
-			res.Err = errors.New("task timeout")
-		}
-	}
-
-	res.CostTime = time.Since(t).Seconds()
-	return res
+	return DoTaskWithContext(context.Background(), fn, timeout)
 }
 
-// DoTaskWithContext 通过上下文context+done+select实现goroutine超时调用
+// DoTaskWithContext 在独立携程中执行fn,超时或者ctx被取消后返回ErrTaskTimeout
 func DoTaskWithContext(ctx context.Context, fn func() interface{}, timeout time.Duration) *TaskRes {
-	t := time.Now()
-	done := make(chan struct{}, 1)
-	res := &TaskRes{
-		Result: make(chan interface{}, 1),
+	res := doTaskWithContext(ctx, fn, timeout)
+	if res.Err == context.DeadlineExceeded || res.Err == context.Canceled {
+		res.Err = ErrTaskTimeout
 	}
 
-	ctx2, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-
-	go func() {
-		defer func() {
-			close(res.Result)
-			close(done)
-			if err := recover(); err != nil {
-				res.Err = fmt.Errorf("%v", err)
-			}
-		}()
-
-		r := fn()
-		res.Result <- r
-	}()
-
-	select {
-	case <-done:
-		log.Println("task has done")
-	case <-ctx2.Done(): // 超时了
-		if res.Err == nil {
-			res.Err = errors.New("task timeout")
-		}
-	}
-
-	res.CostTime = time.Since(t).Seconds()
 	return res
 }
 
-// DoTaskWithTimeoutArgs 采用done+select+time.After实现goroutine超时调用
+// DoTaskWithTimeoutArgs 在独立携程中执行有参数的fn,超时后返回ErrTaskTimeout
 func DoTaskWithTimeoutArgs(fn func(args ...interface{}) interface{}, timeout time.Duration, args ...interface{}) *TaskRes {
-	t := time.Now()
-	done := make(chan struct{}, 1)
-	res := &TaskRes{
-		Result: make(chan interface{}, 1),
-	}
-
-	go func() {
-		defer func() {
-			close(res.Result)
-			close(done)
-			if err := recover(); err != nil {
-				res.Err = fmt.Errorf("%v", err)
-			}
-		}()
-
-		r := fn(args...)
-		res.Result <- r
-	}()
-
-	select {
-	case <-done:
-		log.Println("task has done")
-	case <-time.After(timeout):
-		if res.Err == nil {
-			res.Err = errors.New("task timeout")
-		}
-	}
-
-	res.CostTime = time.Since(t).Seconds()
-	return res
+	return DoTaskWithTimeout(func() interface{} {
+		return fn(args...)
+	}, timeout)
 }
 
-// DoTaskWithContextArgs 通过上下文context+done+select实现goroutine超时调用
+// DoTaskWithContextArgs 在独立携程中执行有参数的fn,超时或者ctx被取消后返回ctx.Err()
 func DoTaskWithContextArgs(ctx context.Context, fn func(args ...interface{}) interface{}, timeout time.Duration, args ...interface{}) *TaskRes {
-	t := time.Now()
-	done := make(chan struct{}, 1)
-	res := &TaskRes{
-		Result: make(chan interface{}, 1),
-	}
+	return doTaskWithContext(ctx, func() interface{} {
+		return fn(args...)
+	}, timeout)
+}
 
-	ctx2, cancel := context.WithTimeout(ctx, timeout)
+// doTaskWithContext 在独立携程中执行fn,超时或者ctx被取消后不再等待fn执行完毕
+func doTaskWithContext(ctx context.Context, fn func() interface{}, timeout time.Duration) *TaskRes {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	go func() {
-		defer func() {
-			close(res.Result)
-			close(done)
-			if err := recover(); err != nil {
-				res.Err = fmt.Errorf("%v", err)
-			}
-		}()
-
-		r := fn(args...)
-		res.Result <- r
-	}()
-
-	select {
-	case <-done:
-		log.Println("task has done")
-	case <-ctx2.Done(): // 超时了
-		if res.Err == nil {
-			res.Err = ctx2.Err()
-		}
-	}
-
-	res.CostTime = time.Since(t).Seconds()
-
-	return res
+	return Go(ctx, func(ctx context.Context) (interface{}, error) {
+		return fn(), nil
+	}).Result()
 }
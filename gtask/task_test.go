@@ -0,0 +1,191 @@
+package gtask
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGo(t *testing.T) {
+	h := Go(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return 1, nil
+	})
+
+	if v, err := h.Wait(); v != 1 || err != nil {
+		t.Fatalf("unexpected result: %v,error: %v", v, err)
+	}
+
+	if res := h.Result(); <-res.Result != 1 || res.Err != nil {
+		t.Fatalf("unexpected task res: %+v", res)
+	}
+
+	// cancel the task.
+	h = Go(context.Background(), func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	h.Cancel()
+	<-h.Done()
+	if _, err := h.Wait(); err != context.Canceled {
+		t.Fatalf("expected context.Canceled,got: %v", err)
+	}
+
+	// catch panic with stack.
+	h = Go(context.Background(), func(ctx context.Context) (interface{}, error) {
+		var m map[string]int
+		m["a"] = 1
+		return nil, nil
+	})
+
+	var pe *PanicError
+	if _, err := h.Wait(); !errors.As(err, &pe) || len(pe.Stack) == 0 {
+		t.Fatalf("expected panic error,got: %v", err)
+	}
+}
+
+func TestDoTaskWithTimeout(t *testing.T) {
+	res := DoTaskWithTimeout(func() interface{} {
+		time.Sleep(200 * time.Millisecond)
+		return 1
+	}, 10*time.Millisecond)
+
+	if res.Err != ErrTaskTimeout || <-res.Result != nil {
+		t.Fatalf("unexpected task res: %+v", res)
+	}
+
+	res = DoTaskWithArgs(func(args ...interface{}) interface{} {
+		return args[0].(int) + args[1].(int)
+	}, 1, 2)
+
+	if res.Err != nil || <-res.Result != 3 {
+		t.Fatalf("unexpected task res: %+v", res)
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	sleep := func(d time.Duration, v interface{}, err error) Func {
+		return func(ctx context.Context) (interface{}, error) {
+			select {
+			case <-time.After(d):
+				return v, err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	errTask := errors.New("task error")
+	values, err := All(context.Background(), sleep(20*time.Millisecond, 1, nil), sleep(0, 2, nil))
+	if err != nil || values[0] != 1 || values[1] != 2 {
+		t.Fatalf("unexpected values: %v,error: %v", values, err)
+	}
+
+	start := time.Now()
+	if _, err = All(context.Background(), sleep(time.Second, 1, nil), sleep(0, nil, errTask)); err != errTask {
+		t.Fatalf("expected task error,got: %v", err)
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("All does not cancel other tasks")
+	}
+
+	v, err := Any(context.Background(), sleep(0, nil, errTask), sleep(20*time.Millisecond, 2, nil), sleep(time.Second, 3, nil))
+	if err != nil || v != 2 {
+		t.Fatalf("unexpected value: %v,error: %v", v, err)
+	}
+
+	if _, err = Any(context.Background(), sleep(0, nil, errTask)); !errors.Is(err, ErrAllFailed) {
+		t.Fatalf("expected ErrAllFailed,got: %v", err)
+	}
+
+	v, err = Race(context.Background(), sleep(20*time.Millisecond, 1, nil), sleep(0, nil, errTask))
+	if err != errTask || v != nil {
+		t.Fatalf("unexpected value: %v,error: %v", v, err)
+	}
+
+	// at most 2 tasks run at the same time.
+	var running, max int32
+	fns := make([]Func, 10)
+	for i := range fns {
+		fns[i] = func(ctx context.Context) (interface{}, error) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil, nil
+		}
+	}
+
+	if _, err = WithLimit(2).All(context.Background(), fns...); err != nil || max != 2 {
+		t.Fatalf("unexpected max running: %d,error: %v", max, err)
+	}
+}
+
+func TestFlight(t *testing.T) {
+	f := NewFlight(WithTTL(50 * time.Millisecond))
+	var calls int32
+	load := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := f.Do("key", load); v != "value" || err != nil {
+				t.Errorf("unexpected value: %v,error: %v", v, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected 1 call,got: %d", n)
+	}
+
+	// the result is cached in ttl.
+	f.Do("key", load)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected cached result,calls: %d", n)
+	}
+
+	f.Forget("key")
+	f.Do("key", load)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expected 2 calls after forget,got: %d", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := f.DoContext(ctx, "other", load); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded,got: %v", err)
+	}
+
+	// errors are shared but not cached.
+	errLoad := errors.New("load error")
+	for i := 0; i < 2; i++ {
+		if _, err := f.Do("err", func() (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, errLoad
+		}); err != errLoad {
+			t.Fatalf("expected load error,got: %v", err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 5 {
+		t.Fatalf("expected 5 calls,got: %d", n)
+	}
+}
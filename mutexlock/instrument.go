@@ -0,0 +1,285 @@
+package mutexlock
+
+import (
+	"context"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Logger log interface
+type Logger interface {
+	Println(args ...interface{})
+}
+
+// LogEntry 调试模式默认的日志输出实例
+var LogEntry Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+var (
+	// lockWait 等待加锁的时间分布,从10us到2.6s
+	lockWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mutexlock_wait_seconds",
+			Help:    "Time waiting to acquire the lock in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+		},
+		[]string{"lock"},
+	)
+
+	// lockHold 持有锁的时间分布
+	lockHold = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mutexlock_hold_seconds",
+			Help:    "Time holding the lock in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+		},
+		[]string{"lock"},
+	)
+
+	// lockTryFailed TryLock失败次数
+	lockTryFailed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mutexlock_try_failed_total",
+			Help: "Number of failed try-locks",
+		},
+		[]string{"lock"},
+	)
+
+	registerOnce sync.Once
+)
+
+// Stats 锁的统计数据
+type Stats struct {
+	Acquired  int64         // 加锁成功次数
+	Contended int64         // 需要等待才加锁成功的次数
+	FailedTry int64         // TryLock失败次数
+	WaitTime  time.Duration // 累计等待加锁的时间
+	MaxWait   time.Duration // 最长的一次等待时间
+	HoldTime  time.Duration // 累计持有锁的时间
+	MaxHold   time.Duration // 最长的一次持有时间
+}
+
+// Instrument 记录锁的监控指标,调试模式下等待超过阈值时打印持有者的调用栈
+// nil *Instrument可以直接使用,只调用传入的加锁和解锁函数,没有额外的开销
+type Instrument struct {
+	name   string        // 监控指标中lock标签的值
+	debug  time.Duration // 等待加锁超过debug时打印持有者的调用栈
+	logger Logger        // 调试模式日志输出实例
+
+	wait      prometheus.Observer
+	hold      prometheus.Observer
+	tryFailed prometheus.Counter
+
+	mu        sync.Mutex
+	stats     Stats
+	holdStart time.Time // 持有者获得锁的时间
+	holder    []byte    // 调试模式下持有者获得锁时的调用栈
+}
+
+// Option 采用func Option功能模式为Instrument添加参数
+type Option func(in *Instrument)
+
+// WithMetrics 将锁的监控指标注册到prometheus.DefaultRegisterer,name作为指标的lock标签
+// 包括等待加锁的时间分布,持有锁的时间分布和TryLock失败次数
+func WithMetrics(name string) Option {
+	return func(in *Instrument) {
+		in.name = name
+	}
+}
+
+// WithDebug 开启调试模式,等待加锁超过threshold时打印当前持有者获得锁时的调用栈
+// 每次加锁成功都需要获取调用栈,只建议排查问题时开启
+func WithDebug(threshold time.Duration) Option {
+	return func(in *Instrument) {
+		in.debug = threshold
+	}
+}
+
+// WithLogger 设置调试模式打印日志的句柄,默认LogEntry
+func WithLogger(l Logger) Option {
+	return func(in *Instrument) {
+		in.logger = l
+	}
+}
+
+// NewInstrument 创建Instrument,没有option时返回nil
+func NewInstrument(opts ...Option) *Instrument {
+	if len(opts) == 0 {
+		return nil
+	}
+
+	in := &Instrument{}
+	for _, o := range opts {
+		o(in)
+	}
+
+	if in.logger == nil {
+		in.logger = LogEntry
+	}
+
+	if in.name != "" {
+		registerOnce.Do(func() {
+			for _, c := range []prometheus.Collector{lockWait, lockHold, lockTryFailed} {
+				if err := prometheus.Register(c); err != nil {
+					in.logger.Println("register mutexlock metrics error: ", err)
+				}
+			}
+		})
+
+		in.wait = lockWait.WithLabelValues(in.name)
+		in.hold = lockHold.WithLabelValues(in.name)
+		in.tryFailed = lockTryFailed.WithLabelValues(in.name)
+	}
+
+	return in
+}
+
+// Lock 先调用try尝试加锁,失败后调用lock阻塞加锁,并记录等待时间
+func (in *Instrument) Lock(try func() bool, lock func()) {
+	if in == nil {
+		lock()
+		return
+	}
+
+	in.acquire(try, func() error {
+		lock()
+		return nil
+	})
+}
+
+// LockContext 先调用try尝试加锁,失败后调用lock阻塞加锁,lock返回错误时没有获得锁
+func (in *Instrument) LockContext(ctx context.Context, try func() bool, lock func(ctx context.Context) error) error {
+	if in == nil {
+		return lock(ctx)
+	}
+
+	return in.acquire(try, func() error {
+		return lock(ctx)
+	})
+}
+
+// TryLock 调用try尝试加锁,记录失败次数
+func (in *Instrument) TryLock(try func() bool) bool {
+	if in == nil {
+		return try()
+	}
+
+	if try() {
+		in.acquired(0, false)
+		return true
+	}
+
+	in.mu.Lock()
+	in.stats.FailedTry++
+	in.mu.Unlock()
+
+	if in.tryFailed != nil {
+		in.tryFailed.Inc()
+	}
+
+	return false
+}
+
+// Unlock 记录持有时间后调用unlock解锁
+func (in *Instrument) Unlock(unlock func()) {
+	if in == nil {
+		unlock()
+		return
+	}
+
+	in.mu.Lock()
+	d := time.Since(in.holdStart)
+	in.stats.HoldTime += d
+	if d > in.stats.MaxHold {
+		in.stats.MaxHold = d
+	}
+
+	in.holder = nil
+	in.mu.Unlock()
+
+	if in.hold != nil {
+		in.hold.Observe(d.Seconds())
+	}
+
+	unlock()
+}
+
+// Stats 返回锁的统计数据,nil *Instrument返回零值
+func (in *Instrument) Stats() Stats {
+	if in == nil {
+		return Stats{}
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	return in.stats
+}
+
+// acquire 尝试加锁失败后阻塞加锁,调试模式下等待超过阈值时打印持有者的调用栈
+func (in *Instrument) acquire(try func() bool, block func() error) error {
+	if try() {
+		in.acquired(0, false)
+		return nil
+	}
+
+	start := time.Now()
+	if in.debug > 0 {
+		timer := time.AfterFunc(in.debug, in.report)
+		defer timer.Stop()
+	}
+
+	if err := block(); err != nil {
+		return err
+	}
+
+	in.acquired(time.Since(start), true)
+	return nil
+}
+
+// acquired 记录一次加锁成功,调试模式下保存持有者的调用栈
+func (in *Instrument) acquired(wait time.Duration, contended bool) {
+	var stack []byte
+	if in.debug > 0 {
+		stack = make([]byte, 4096)
+		stack = stack[:runtime.Stack(stack, false)]
+	}
+
+	in.mu.Lock()
+	in.stats.Acquired++
+	if contended {
+		in.stats.Contended++
+	}
+
+	in.stats.WaitTime += wait
+	if wait > in.stats.MaxWait {
+		in.stats.MaxWait = wait
+	}
+
+	in.holdStart = time.Now()
+	in.holder = stack
+	in.mu.Unlock()
+
+	if in.wait != nil {
+		in.wait.Observe(wait.Seconds())
+	}
+}
+
+// report 打印当前持有者获得锁时的调用栈
+func (in *Instrument) report() {
+	in.mu.Lock()
+	held := time.Since(in.holdStart)
+	stack := in.holder
+	in.mu.Unlock()
+
+	if stack == nil {
+		in.logger.Println("wait for lock", in.name, "exceeds", in.debug, "holder is unknown")
+		return
+	}
+
+	in.logger.Println("wait for lock", in.name, "exceeds", in.debug, "held for", held, "holder stack:\n"+string(stack))
+}
@@ -5,34 +5,88 @@
 package mutexlock
 
 import (
+	"context"
 	"sync"
-	"sync/atomic"
-	"unsafe"
 )
 
-const mutexLocked = 1 << iota
+// Locker 互斥锁接口,Mutex和chanlock.ChanLock都实现了该接口
+type Locker interface {
+	// Lock 阻塞加锁
+	Lock()
 
-// NewMutexLock 创建lock实例
-func NewMutexLock() *Mutex {
-	return &Mutex{}
+	// Unlock 解锁
+	Unlock()
+
+	// TryLock 尝试加锁,不会阻塞,加锁成功返回true
+	TryLock() bool
+
+	// LockContext 阻塞加锁,直到加锁成功或者ctx被取消
+	// ctx被取消后返回ctx.Err(),不会持有锁
+	LockContext(ctx context.Context) error
+}
+
+// NewMutexLock 创建lock实例,opts可以开启监控指标和调试模式
+func NewMutexLock(opts ...Option) *Mutex {
+	return &Mutex{ins: NewInstrument(opts...)}
 }
 
-// Mutex mutex
+// Mutex mutex,零值可以直接使用,但是不会记录监控指标
 type Mutex struct {
-	in sync.Mutex
+	mu  sync.Mutex
+	ins *Instrument
 }
 
 // Lock 加锁
 func (m *Mutex) Lock() {
-	m.in.Lock()
+	m.ins.Lock(m.mu.TryLock, m.mu.Lock)
 }
 
 // Unlock 解锁
 func (m *Mutex) Unlock() {
-	m.in.Unlock()
+	m.ins.Unlock(m.mu.Unlock)
 }
 
 // TryLock 尝试枷锁
 func (m *Mutex) TryLock() bool {
-	return atomic.CompareAndSwapInt32((*int32)(unsafe.Pointer(&m.in)), 0, mutexLocked)
+	return m.ins.TryLock(m.mu.TryLock)
+}
+
+// LockContext 阻塞加锁,直到加锁成功或者ctx被取消
+// sync.Mutex的等待不能被取消,ctx被取消后等待的goroutine获得锁后会立即释放
+func (m *Mutex) LockContext(ctx context.Context) error {
+	return m.ins.LockContext(ctx, m.mu.TryLock, m.lockContext)
+}
+
+// Stats 返回锁的统计数据,没有开启监控指标和调试模式时返回零值
+func (m *Mutex) Stats() Stats {
+	return m.ins.Stats()
+}
+
+func (m *Mutex) lockContext(ctx context.Context) error {
+	if m.mu.TryLock() {
+		return nil
+	}
+
+	if ctx.Done() == nil {
+		m.mu.Lock()
+		return nil
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		m.mu.Lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			m.mu.Unlock()
+		}()
+
+		return ctx.Err()
+	}
 }
@@ -1,7 +1,14 @@
 package mutexlock
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestTryLock(t *testing.T) {
@@ -43,6 +50,82 @@ func TestRace(t *testing.T) {
 
 }
 
+func TestLockContext(t *testing.T) {
+	var locker Locker = NewMutexLock()
+	locker.Lock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := locker.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded,got: %v", err)
+	}
+
+	locker.Unlock()
+
+	// 被取消的等待获得锁后会立即释放
+	if err := locker.LockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	locker.Unlock()
+}
+
+// logBuffer 并发安全的日志输出
+type logBuffer struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (b *logBuffer) Println(args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.logs = append(b.logs, fmt.Sprintln(args...))
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return strings.Join(b.logs, "")
+}
+
+func TestInstrument(t *testing.T) {
+	logs := &logBuffer{}
+	tryFailed := testutil.ToFloat64(lockTryFailed.WithLabelValues("test"))
+	m := NewMutexLock(WithMetrics("test"), WithDebug(10*time.Millisecond), WithLogger(logs))
+	m.Lock()
+	if m.TryLock() {
+		t.Fatal("acquired the held lock")
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		m.Unlock()
+	}()
+
+	m.Lock()
+	m.Unlock()
+
+	stats := m.Stats()
+	if stats.Acquired != 2 || stats.Contended != 1 || stats.FailedTry != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if stats.MaxWait < 20*time.Millisecond || stats.MaxHold < 20*time.Millisecond {
+		t.Fatalf("unexpected wait and hold time: %+v", stats)
+	}
+
+	if s := logs.String(); !strings.Contains(s, "holder stack") || !strings.Contains(s, "TestInstrument") {
+		t.Fatalf("the holder stack is not reported: %s", s)
+	}
+
+	// the counter is global,compare the increment of this run.
+	if n := testutil.ToFloat64(lockTryFailed.WithLabelValues("test")) - tryFailed; n != 1 {
+		t.Fatalf("unexpected try failed metric: %v", n)
+	}
+}
+
 /**
 $ go test -v
 === RUN   TestTryLock
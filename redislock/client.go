@@ -0,0 +1,80 @@
+package redislock
+
+import (
+	"strings"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/gomodule/redigo/redis"
+)
+
+// script 同时支持redigo和go-redis的lua脚本
+type script struct {
+	redigo  *redis.Script
+	goredis *goredis.Script
+}
+
+// newScript 创建有keyCount个key的lua脚本
+func newScript(keyCount int, src string) *script {
+	return &script{
+		redigo:  redis.NewScript(keyCount, src),
+		goredis: goredis.NewScript(src),
+	}
+}
+
+// client 执行lua脚本的redis客户端,返回整数结果
+type client interface {
+	eval(s *script, keys []string, args ...interface{}) (int64, error)
+}
+
+// connClient 基于单个redigo连接,连接不是并发安全的,调用方需要加锁
+type connClient struct {
+	conn redis.Conn
+}
+
+func (c connClient) eval(s *script, keys []string, args ...interface{}) (int64, error) {
+	return redigoEval(c.conn, s, keys, args...)
+}
+
+// poolClient 基于redigo连接池,每次执行从连接池获取连接
+type poolClient struct {
+	pool *redis.Pool
+}
+
+func (c poolClient) eval(s *script, keys []string, args ...interface{}) (int64, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	return redigoEval(conn, s, keys, args...)
+}
+
+// redigoEval 通过redigo连接执行lua脚本
+func redigoEval(conn redis.Conn, s *script, keys []string, args ...interface{}) (int64, error) {
+	keysAndArgs := make([]interface{}, 0, len(keys)+len(args))
+	for _, key := range keys {
+		keysAndArgs = append(keysAndArgs, key)
+	}
+
+	keysAndArgs = append(keysAndArgs, args...)
+	return redis.Int64(s.redigo.Do(conn, keysAndArgs...))
+}
+
+// goredisClient 基于go-redis的redis.Client或者redis.ClusterClient
+type goredisClient struct {
+	client goredis.Cmdable
+}
+
+func (c goredisClient) eval(s *script, keys []string, args ...interface{}) (int64, error) {
+	return s.goredis.Run(c.client, keys, args...).Int64()
+}
+
+// fenceKey 返回存放fencing token的key,和加锁的key在redis集群的同一个slot中
+// key已经有hash tag时直接使用,否则将key作为hash tag
+func fenceKey(key string) string {
+	if start := strings.Index(key, "{"); start >= 0 {
+		if end := strings.Index(key[start+1:], "}"); end > 0 {
+			return key + ":fence"
+		}
+	}
+
+	return "{" + key + "}:fence"
+}
@@ -1,10 +1,14 @@
 package redislock
 
 import (
+	"context"
 	"log"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis"
 	"github.com/gomodule/redigo/redis"
 )
 
@@ -55,6 +59,337 @@ func TestLock(t *testing.T) {
 	log.Println("ok")
 }
 
+// dial 连接miniredis
+func dial(t *testing.T, mr *miniredis.Miniredis) redis.Conn {
+	conn, err := redis.Dial("tcp", mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+// TestFence 测试阻塞加锁和fencing token
+func TestFence(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mr.Close()
+
+	a := NewLock(dial(t, mr), "order", WithTTL(500*time.Millisecond))
+	b := NewLock(dial(t, mr), "order", WithTTL(500*time.Millisecond), WithRetry(5*time.Millisecond, 20*time.Millisecond))
+	if a.Value() == b.Value() {
+		t.Fatal("owner tokens should be unique")
+	}
+
+	fence, err := a.Lock(context.Background())
+	if err != nil || fence != 1 {
+		t.Fatalf("unexpected fence: %d,error: %v", fence, err)
+	}
+
+	if ttl := mr.TTL("order"); ttl != 500*time.Millisecond {
+		t.Fatalf("unexpected ttl: %v", ttl)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err = b.Lock(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded,got: %v", err)
+	}
+
+	// b can not release the lock held by a.
+	b.Unlock()
+	if !mr.Exists("order") {
+		t.Fatal("the lock is released by other client")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		a.Unlock()
+	}()
+
+	fence, err = b.Lock(context.Background())
+	if err != nil || fence != 2 {
+		t.Fatalf("unexpected fence: %d,error: %v", fence, err)
+	}
+}
+
+// TestWatchdog 测试自动续期
+func TestWatchdog(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mr.Close()
+
+	l := NewLock(dial(t, mr), "job", WithTTL(90*time.Millisecond), WithWatchdog())
+	if ok, err := l.TryLock(); !ok || err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+
+	// the watchdog extends the ttl every 30ms.
+	mr.FastForward(60 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if ttl := mr.TTL("job"); ttl <= 30*time.Millisecond {
+		t.Fatalf("the lock is not renewed,ttl: %v", ttl)
+	}
+
+	// the lock is lost after it is taken by another client.
+	mr.Set("job", "other")
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("the lost lock is not detected")
+	}
+
+	l.Unlock()
+	if v, _ := mr.Get("job"); v != "other" {
+		t.Fatalf("the lock of other client is released: %s", v)
+	}
+}
+
+// TestLocker 测试不同redis客户端实现的Locker
+func TestLocker(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mr.Close()
+
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", mr.Addr())
+		},
+	}
+
+	defer pool.Close()
+
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	cluster := goredis.NewClusterClient(&goredis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	defer cluster.Close()
+
+	lockers := []Locker{
+		NewPoolLock(pool, "pay"),
+		NewGoRedisLock(client, "pay"),
+		NewClusterLock(cluster, "pay"),
+	}
+
+	for i, l := range lockers {
+		fence, err := l.Lock(context.Background())
+		if err != nil || fence != int64(i+1) {
+			t.Fatalf("locker %d unexpected fence: %d,error: %v", i, fence, err)
+		}
+
+		for j, other := range lockers {
+			if ok, err := other.TryLock(); j != i && (ok || err != nil) {
+				t.Fatalf("locker %d acquired the lock held by %d,error: %v", j, i, err)
+			}
+		}
+
+		if ok, err := l.Refresh(); !ok || err != nil {
+			t.Fatalf("locker %d refresh failed: %v", i, err)
+		}
+
+		if err := l.Unlock(); err != nil || mr.Exists("pay") {
+			t.Fatalf("locker %d unlock failed: %v", i, err)
+		}
+	}
+
+	if v, _ := mr.Get("{pay}:fence"); v != "3" {
+		t.Fatalf("unexpected fence: %s", v)
+	}
+}
+
+// TestRedlock 测试在多个独立redis节点上加锁
+func TestRedlock(t *testing.T) {
+	var nodes []*miniredis.Miniredis
+	var pools []*redis.Pool
+	for i := 0; i < 3; i++ {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer mr.Close()
+		nodes = append(nodes, mr)
+
+		addr := mr.Addr()
+		pool := &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", addr)
+			},
+		}
+
+		defer pool.Close()
+		pools = append(pools, pool)
+	}
+
+	var l Locker = NewRedlock(pools, "order", WithTTL(time.Second))
+	fence, err := l.Lock(context.Background())
+	if err != nil || fence != 1 {
+		t.Fatalf("unexpected fence: %d,error: %v", fence, err)
+	}
+
+	other := NewRedlock(pools, "order", WithTTL(time.Second))
+	if ok, err := other.TryLock(); ok || err != nil {
+		t.Fatalf("acquired the lock held by other client,error: %v", err)
+	}
+
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 少数节点被其他client持有,仍然可以过半加锁成功
+	nodes[0].Set("order", "other")
+	if ok, err := other.TryLock(); !ok || err != nil {
+		t.Fatalf("lock with quorum failed: %v", err)
+	}
+
+	if other.ValidUntil().Before(time.Now()) {
+		t.Fatal("unexpected validity")
+	}
+
+	if err := other.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 过半节点被其他client持有,加锁失败后释放已经获得的节点
+	nodes[1].Set("order", "other")
+	if ok, err := l.TryLock(); ok || err != nil {
+		t.Fatalf("acquired the lock without quorum,error: %v", err)
+	}
+
+	if nodes[2].Exists("order") {
+		t.Fatal("the lock is not released after failure")
+	}
+
+	if v, _ := nodes[0].Get("order"); v != "other" {
+		t.Fatalf("the lock of other client is released: %s", v)
+	}
+
+	nodes[0].Del("order")
+	nodes[1].Del("order")
+
+	// 单个节点故障,仍然可以加锁和续期
+	nodes[2].Close()
+	if ok, err := l.TryLock(); !ok || err != nil {
+		t.Fatalf("lock with one node down failed: %v", err)
+	}
+
+	if ok, err := l.Refresh(); !ok || err != nil {
+		t.Fatalf("refresh with one node down failed: %v", err)
+	}
+
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 过半节点故障,返回错误
+	nodes[1].Close()
+	if ok, err := l.TryLock(); ok || err == nil {
+		t.Fatal("lock without quorum should return error")
+	}
+}
+
+// TestReentrantLock 测试可重入锁
+func TestReentrantLock(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mr.Close()
+
+	a := NewReentrantLock(NewLock(dial(t, mr), "order", WithTTL(time.Second)))
+	b := NewReentrantLock(NewLock(dial(t, mr), "order", WithTTL(time.Second)))
+	for i := 1; i <= 2; i++ {
+		fence, err := a.Lock(context.Background())
+		if err != nil || fence != int64(i) || a.Holds() != i {
+			t.Fatalf("unexpected fence: %d,holds: %d,error: %v", fence, a.Holds(), err)
+		}
+	}
+
+	if ok, err := b.TryLock(); ok || err != nil {
+		t.Fatalf("acquired the lock held by other client,error: %v", err)
+	}
+
+	if err := b.Unlock(); err != ErrNotHeld {
+		t.Fatalf("expected ErrNotHeld,got: %v", err)
+	}
+
+	if err := a.Unlock(); err != nil || !mr.Exists("order") {
+		t.Fatalf("the lock is released before all holds are released: %v", err)
+	}
+
+	if ok, err := a.Refresh(); !ok || err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	if err := a.Unlock(); err != nil || mr.Exists("order") {
+		t.Fatalf("unlock failed: %v", err)
+	}
+
+	fence, err := b.Lock(context.Background())
+	if err != nil || fence != 3 {
+		t.Fatalf("unexpected fence: %d,error: %v", fence, err)
+	}
+}
+
+// TestRWLock 测试读写锁
+func TestRWLock(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mr.Close()
+
+	r1 := NewRWLock(NewLock(dial(t, mr), "stock", WithTTL(time.Second)))
+	r2 := NewRWLock(NewLock(dial(t, mr), "stock", WithTTL(time.Second)))
+	w := NewRWLock(NewLock(dial(t, mr), "stock", WithTTL(time.Second), WithRetry(5*time.Millisecond, 10*time.Millisecond)))
+	if _, err := r1.RLock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := r2.TryRLock(); !ok || err != nil {
+		t.Fatalf("readers should share the lock: %v", err)
+	}
+
+	if ok, err := w.TryLock(); ok || err != nil {
+		t.Fatalf("writer acquired the lock held by readers,error: %v", err)
+	}
+
+	// 持有读锁时不能加写锁
+	if ok, err := r1.TryLock(); ok || err != nil {
+		t.Fatalf("reader upgraded to writer,error: %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		r1.RUnlock()
+		r2.RUnlock()
+	}()
+
+	fence, err := w.Lock(context.Background())
+	if err != nil || fence != 3 {
+		t.Fatalf("unexpected fence: %d,error: %v", fence, err)
+	}
+
+	if ok, err := r1.TryRLock(); ok || err != nil {
+		t.Fatalf("reader acquired the lock held by writer,error: %v", err)
+	}
+
+	if err := w.Unlock(); err != nil || mr.Exists("stock") {
+		t.Fatalf("unlock failed: %v", err)
+	}
+}
+
 /**
 2019/08/10 23:36:13 lock fail
 2019/08/10 23:36:13 err:  <nil>
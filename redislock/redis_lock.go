@@ -1,55 +1,251 @@
 package redislock
 
 import (
+	"context"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis"
 	"github.com/gomodule/redigo/redis"
+	uuid "github.com/satori/go.uuid"
 )
 
 var DefaultExpire = 10 // 加锁的key默认过期时间，单位s
 
+// Locker 分布式锁接口,Lock基于redigo和go-redis实现了该接口
+type Locker interface {
+	// TryLock 尝试加锁,锁被其他client持有返回false,nil
+	TryLock() (bool, error)
+
+	// Lock 阻塞加锁,直到加锁成功或者ctx被取消,返回fencing token
+	Lock(ctx context.Context) (int64, error)
+
+	// Refresh 锁续期,锁已经过期或者被其他client持有返回false,nil
+	Refresh() (bool, error)
+
+	// Unlock 释放锁
+	Unlock() error
+
+	// Fence 返回最近一次加锁成功的fencing token
+	Fence() int64
+}
+
 // Lock lock data.
 type Lock struct {
-	conn   redis.Conn  // redis连接句柄，支持redis pool连接句柄
-	expire int         // 设置加锁key的过期时间
-	key    string      // 加锁的key
-	val    interface{} // 加锁的value
+	client   client        // 执行lua脚本的redis客户端
+	expire   time.Duration // 设置加锁key的过期时间,精确到毫秒
+	key      string        // 加锁的key
+	val      interface{}   // 加锁的value,也就是锁的持有者token
+	fenceKey string        // 存放fencing token的key
+	watchdog bool          // 获得锁后是否自动续期
+	minRetry time.Duration // Lock重试的最小间隔
+	maxRetry time.Duration // Lock重试的最大间隔
+
+	mu    sync.Mutex // 单个redis.Conn不是并发安全的,watchdog和调用方共用连接
+	fence int64      // 最近一次获得锁的fencing token
+	wd    watchdog   // 获得锁后自动续期
+}
+
+// Option 采用func Option功能模式为Lock添加参数
+type Option func(l *Lock)
+
+// WithValue 设置加锁的value,默认自动生成唯一的token
+// 多个client使用相同的value会导致释放其他client的锁
+func WithValue(val interface{}) Option {
+	return func(l *Lock) {
+		l.val = val
+	}
+}
+
+// WithTTL 设置加锁key的过期时间,精确到毫秒,默认DefaultExpire秒
+func WithTTL(d time.Duration) Option {
+	return func(l *Lock) {
+		l.expire = d
+	}
+}
+
+// WithWatchdog 获得锁后每隔ttl/3自动续期,直到Unlock
+// 持有锁的进程崩溃后,锁在ttl之后自动过期
+func WithWatchdog() Option {
+	return func(l *Lock) {
+		l.watchdog = true
+	}
+}
+
+// WithRetry 设置Lock获取锁失败后重试的间隔,从min开始每次翻倍,最大max,默认10ms到1s
+func WithRetry(min, max time.Duration) Option {
+	return func(l *Lock) {
+		l.minRetry = min
+		l.maxRetry = max
+	}
 }
 
 // New 实例化redis分布式锁实例对象
+// val为nil时自动生成唯一的token,expire单位s
+// conn长时间使用可能会断开,建议使用NewPoolLock
 func New(conn redis.Conn, key string, val interface{}, expire int) *Lock {
 	if expire <= 0 {
 		expire = DefaultExpire
 	}
 
-	return &Lock{
-		key:    key,
-		conn:   conn,
-		val:    val,
-		expire: expire,
+	return NewLock(conn, key, WithValue(val), WithTTL(time.Duration(expire)*time.Second))
+}
+
+// NewLock 通过option创建基于单个redigo连接的redis分布式锁实例对象
+func NewLock(conn redis.Conn, key string, opts ...Option) *Lock {
+	return newLock(connClient{conn: conn}, key, opts...)
+}
+
+// NewPoolLock 创建基于redigo连接池的redis分布式锁实例对象
+// 每次执行命令从连接池获取连接,pool可以是gredigo.NewRedisPool创建的连接池
+func NewPoolLock(pool *redis.Pool, key string, opts ...Option) *Lock {
+	return newLock(poolClient{pool: pool}, key, opts...)
+}
+
+// NewGoRedisLock 创建基于go-redis的redis分布式锁实例对象
+// client可以是goredis.RedisClientConf.GetClient()创建的redis.Client
+func NewGoRedisLock(client *goredis.Client, key string, opts ...Option) *Lock {
+	return newLock(goredisClient{client: client}, key, opts...)
+}
+
+// NewClusterLock 创建基于go-redis集群的redis分布式锁实例对象
+// cluster可以是goredis.RedisClusterConf.GetCluster()创建的redis.ClusterClient
+func NewClusterLock(cluster *goredis.ClusterClient, key string, opts ...Option) *Lock {
+	return newLock(goredisClient{client: cluster}, key, opts...)
+}
+
+// newLock 创建分布式锁实例对象
+// fencing token存放在{key}:fence中,和key在redis集群的同一个slot中
+func newLock(c client, key string, opts ...Option) *Lock {
+	lock := &Lock{
+		client:   c,
+		key:      key,
+		fenceKey: fenceKey(key),
+		expire:   time.Duration(DefaultExpire) * time.Second,
+		minRetry: 10 * time.Millisecond,
+		maxRetry: time.Second,
 	}
+
+	for _, o := range opts {
+		o(lock)
+	}
+
+	if lock.val == nil || lock.val == "" {
+		lock.val = uuid.NewV4().String()
+	}
+
+	if lock.expire < time.Millisecond {
+		lock.expire = time.Duration(DefaultExpire) * time.Second
+	}
+
+	if lock.minRetry <= 0 {
+		lock.minRetry = 10 * time.Millisecond
+	}
+
+	if lock.maxRetry < lock.minRetry {
+		lock.maxRetry = lock.minRetry
+	}
+
+	return lock
 }
 
 // delScript lua脚本删除一个key保证原子性，采用lua脚本执行
 // 保证原子性（redis是单线程），避免del删除了，其他client获得的lock
-var delScript = redis.NewScript(1, `
+var delScript = newScript(1, `
 if redis.call("get", KEYS[1]) == ARGV[1] then
 	return redis.call("del", KEYS[1])
 else
 	return 0
 end`)
 
+// lockScript lua脚本加锁,加锁成功后fencing token加1并返回,失败返回0
+var lockScript = newScript(2, `
+if redis.call("set", KEYS[1], ARGV[1], "PX", ARGV[2], "NX") then
+	return redis.call("incr", KEYS[2])
+else
+	return 0
+end`)
+
+// refreshScript lua脚本续期一个key,只有value相同才续期
+// 避免锁过期后被其他client获得,又被续期
+var refreshScript = newScript(1, `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+	return 0
+end`)
+
 // Unlock 释放锁采用redis lua脚步执行，成功返回nil
 func (lock *Lock) Unlock() error {
-	_, err := delScript.Do(lock.conn, lock.key, lock.val)
+	lock.wd.halt()
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	_, err := lock.client.eval(delScript, []string{lock.key}, lock.val)
 	return err
 }
 
 // TryLock 尝试加锁,如果加锁成功就返回true,nil
-// 利用redis setEx nx的原子性实现分布式锁
+// 利用redis set nx px的原子性实现分布式锁,锁被其他client持有返回false,nil
 func (lock *Lock) TryLock() (bool, error) {
-	_, err := redis.String(lock.conn.Do("SET", lock.key, lock.val, "EX", lock.expire, "NX"))
-	if err != nil {
+	lock.mu.Lock()
+	fence, err := lock.client.eval(lockScript, []string{lock.key, lock.fenceKey}, lock.val, lock.expire.Milliseconds())
+	if err != nil || fence == 0 {
+		lock.mu.Unlock()
 		return false, err
 	}
 
+	lock.fence = fence
+	lock.mu.Unlock()
+
+	if lock.watchdog {
+		lock.wd.start(lock.expire/3, lock.Refresh)
+	}
+
 	return true, nil
 }
+
+// Lock 阻塞加锁,加锁失败后按照指数退避重试,直到加锁成功或者ctx被取消
+// 加锁成功返回fencing token,每次加锁成功fencing token都会递增
+// 下游写入时可以拒绝比已经见过的fencing token小的请求,避免锁过期的client继续写入
+func (lock *Lock) Lock(ctx context.Context) (int64, error) {
+	if err := retry(ctx, lock.minRetry, lock.maxRetry, lock.TryLock); err != nil {
+		return 0, err
+	}
+
+	return lock.Fence(), nil
+}
+
+// Fence 返回最近一次加锁成功的fencing token
+func (lock *Lock) Fence() int64 {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	return lock.fence
+}
+
+// Value 返回加锁的value,也就是锁的持有者token
+func (lock *Lock) Value() interface{} {
+	return lock.val
+}
+
+// Refresh 将锁的过期时间重新设置为expire
+// 锁已经过期或者被其他client持有返回false,nil
+func (lock *Lock) Refresh() (bool, error) {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	n, err := lock.client.eval(refreshScript, []string{lock.key}, lock.val, lock.expire.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// Lost 返回watchdog续期失败后关闭的chan,没有开启watchdog或者没有获得锁时返回nil
+// 锁丢失后持有者应该停止正在执行的写操作
+func (lock *Lock) Lost() <-chan struct{} {
+	return lock.wd.lostCh()
+}
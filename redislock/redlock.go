@@ -0,0 +1,185 @@
+package redislock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// clockDriftFactor 各个redis节点之间的时钟漂移系数
+const clockDriftFactor = 0.01
+
+// Redlock 基于redlock算法的分布式锁,在N个独立的redis节点上加锁
+// 在过半的节点上加锁成功,并且加锁的耗时加上时钟漂移小于锁的过期时间,才算加锁成功
+// 单个节点故障或者主从切换不会导致锁丢失
+type Redlock struct {
+	clients  []client      // 每个独立redis节点的客户端
+	quorum   int           // 需要加锁成功的节点个数
+	expire   time.Duration // 加锁key的过期时间
+	key      string        // 加锁的key
+	val      interface{}   // 加锁的value,也就是锁的持有者token
+	fenceKey string        // 存放fencing token的key
+	watchdog bool          // 获得锁后是否自动续期
+	minRetry time.Duration // Lock重试的最小间隔
+	maxRetry time.Duration // Lock重试的最大间隔
+
+	mu         sync.Mutex
+	fence      int64     // 最近一次获得锁的fencing token
+	validUntil time.Time // 锁的有效期
+	wd         watchdog  // 获得锁后自动续期
+}
+
+// NewRedlock 创建基于N个独立redis节点的分布式锁,pools可以是gredigo.NewRedisPool创建的连接池
+// 节点之间不能是主从关系,option和NewLock一样
+func NewRedlock(pools []*redis.Pool, key string, opts ...Option) *Redlock {
+	lock := newLock(nil, key, opts...)
+	r := &Redlock{
+		clients:  make([]client, 0, len(pools)),
+		quorum:   len(pools)/2 + 1,
+		expire:   lock.expire,
+		key:      lock.key,
+		val:      lock.val,
+		fenceKey: lock.fenceKey,
+		watchdog: lock.watchdog,
+		minRetry: lock.minRetry,
+		maxRetry: lock.maxRetry,
+	}
+
+	for _, pool := range pools {
+		r.clients = append(r.clients, poolClient{pool: pool})
+	}
+
+	return r
+}
+
+// TryLock 尝试在所有节点上加锁,过半节点加锁成功并且锁仍然有效时返回true,nil
+// 加锁失败时释放所有节点上的锁,出错的节点过多无法过半时返回错误
+func (r *Redlock) TryLock() (bool, error) {
+	start := time.Now()
+	acquired, fence, err := r.evalAll(lockScript, []string{r.key, r.fenceKey}, r.val, r.expire.Milliseconds())
+	if validity := r.validity(start); acquired >= r.quorum && validity > 0 {
+		r.mu.Lock()
+		r.fence = fence
+		r.validUntil = start.Add(validity)
+		r.mu.Unlock()
+
+		if r.watchdog {
+			r.wd.start(r.expire/3, r.Refresh)
+		}
+
+		return true, nil
+	}
+
+	r.evalAll(delScript, []string{r.key}, r.val)
+	return false, err
+}
+
+// Lock 阻塞加锁,加锁失败后按照指数退避重试,直到加锁成功或者ctx被取消
+// 加锁成功返回fencing token,它是加锁成功的节点中最大的fencing token
+// 任意两次加锁成功的节点都有交集,但是各个节点的fencing token独立递增,不保证严格递增
+func (r *Redlock) Lock(ctx context.Context) (int64, error) {
+	if err := retry(ctx, r.minRetry, r.maxRetry, r.TryLock); err != nil {
+		return 0, err
+	}
+
+	return r.Fence(), nil
+}
+
+// Refresh 在所有节点上将锁的过期时间重新设置为expire
+// 过半节点续期成功并且锁仍然有效时返回true,nil
+func (r *Redlock) Refresh() (bool, error) {
+	start := time.Now()
+	refreshed, _, err := r.evalAll(refreshScript, []string{r.key}, r.val, r.expire.Milliseconds())
+	if validity := r.validity(start); refreshed >= r.quorum && validity > 0 {
+		r.mu.Lock()
+		r.validUntil = start.Add(validity)
+		r.mu.Unlock()
+		return true, nil
+	}
+
+	return false, err
+}
+
+// Unlock 释放所有节点上的锁
+func (r *Redlock) Unlock() error {
+	r.wd.halt()
+
+	_, _, err := r.evalAll(delScript, []string{r.key}, r.val)
+	return err
+}
+
+// Fence 返回最近一次加锁成功的fencing token
+func (r *Redlock) Fence() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.fence
+}
+
+// ValidUntil 返回最近一次加锁或者续期成功后,锁的有效期
+func (r *Redlock) ValidUntil() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.validUntil
+}
+
+// Lost 返回watchdog续期失败后关闭的chan,没有开启watchdog或者没有获得锁时返回nil
+func (r *Redlock) Lost() <-chan struct{} {
+	return r.wd.lostCh()
+}
+
+// validity 返回从start开始加锁后,锁剩余的有效时间
+// 需要减去加锁的耗时和节点之间的时钟漂移
+func (r *Redlock) validity(start time.Time) time.Duration {
+	drift := time.Duration(float64(r.expire)*clockDriftFactor) + 2*time.Millisecond
+	return r.expire - time.Since(start) - drift
+}
+
+// evalAll 在所有节点上并发执行lua脚本,返回结果大于0的节点个数和最大的结果
+// 出错的节点过多,成功的节点无法过半时,返回第一个错误
+func (r *Redlock) evalAll(s *script, keys []string, args ...interface{}) (int, int64, error) {
+	type result struct {
+		n   int64
+		err error
+	}
+
+	results := make(chan result, len(r.clients))
+	for _, c := range r.clients {
+		go func(c client) {
+			n, err := c.eval(s, keys, args...)
+			results <- result{n: n, err: err}
+		}(c)
+	}
+
+	var ok, failed int
+	var max int64
+	var err error
+	for range r.clients {
+		res := <-results
+		if res.err != nil {
+			failed++
+			if err == nil {
+				err = res.err
+			}
+
+			continue
+		}
+
+		if res.n > 0 {
+			ok++
+		}
+
+		if res.n > max {
+			max = res.n
+		}
+	}
+
+	if failed <= len(r.clients)-r.quorum {
+		err = nil
+	}
+
+	return ok, max, err
+}
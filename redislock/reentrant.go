@@ -0,0 +1,203 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotHeld 释放锁时当前实例没有持有锁,锁可能已经过期
+var ErrNotHeld = errors.New("redislock: lock not held")
+
+const (
+	modeRead  = "read"
+	modeWrite = "write"
+)
+
+// rwLockScript lua脚本加读锁或者写锁,加锁成功后fencing token加1并返回,失败返回0
+// 锁存放在hash中,mode字段是加锁的模式,其他字段是持有者token和持有次数
+// 锁空闲时可以加任意模式的锁;读锁可以被多个持有者同时持有;写锁只能被同一个持有者重入
+var rwLockScript = newScript(2, `
+local mode = redis.call("hget", KEYS[1], "mode")
+if not mode then
+	redis.call("hset", KEYS[1], "mode", ARGV[3])
+elseif mode ~= ARGV[3] or (mode == "write" and redis.call("hexists", KEYS[1], ARGV[1]) == 0) then
+	return 0
+end
+redis.call("hincrby", KEYS[1], ARGV[1], 1)
+redis.call("pexpire", KEYS[1], ARGV[2])
+return redis.call("incr", KEYS[2])`)
+
+// rwUnlockScript lua脚本将持有次数减1,返回剩余的持有次数,没有持有锁返回-1
+// 持有次数为0时删除持有者,没有持有者时删除锁
+var rwUnlockScript = newScript(1, `
+if redis.call("hexists", KEYS[1], ARGV[1]) == 0 then
+	return -1
+end
+local n = redis.call("hincrby", KEYS[1], ARGV[1], -1)
+if n > 0 then
+	redis.call("pexpire", KEYS[1], ARGV[2])
+	return n
+end
+redis.call("hdel", KEYS[1], ARGV[1])
+if redis.call("hlen", KEYS[1]) <= 1 then
+	redis.call("del", KEYS[1])
+end
+return 0`)
+
+// rwRefreshScript lua脚本续期一个hash锁,只有持有锁才续期
+var rwRefreshScript = newScript(1, `
+if redis.call("hexists", KEYS[1], ARGV[1]) == 1 then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+	return 0
+end`)
+
+// ReentrantLock 可重入的分布式锁,同一个持有者可以多次加锁,加锁几次就需要释放几次
+// 每次加锁成功fencing token都会递增,最后一次释放后锁才会被删除
+type ReentrantLock struct {
+	lock  *Lock
+	holds int // 当前实例持有锁的次数,由lock.mu保护
+}
+
+// NewReentrantLock 基于l的redis客户端和option创建可重入锁
+// 可重入锁使用hash存放,l不能再单独对同一个key加锁
+func NewReentrantLock(l *Lock) *ReentrantLock {
+	return &ReentrantLock{lock: l}
+}
+
+// TryLock 尝试加锁,锁空闲或者已经被当前持有者持有时返回true,nil
+// 锁被其他client持有返回false,nil
+func (r *ReentrantLock) TryLock() (bool, error) {
+	return r.acquire(modeWrite)
+}
+
+// Lock 阻塞加锁,加锁失败后按照指数退避重试,直到加锁成功或者ctx被取消
+// 加锁成功返回fencing token
+func (r *ReentrantLock) Lock(ctx context.Context) (int64, error) {
+	if err := retry(ctx, r.lock.minRetry, r.lock.maxRetry, r.TryLock); err != nil {
+		return 0, err
+	}
+
+	return r.Fence(), nil
+}
+
+// Unlock 释放一次锁,持有次数为0时删除锁
+// 当前实例没有持有锁时返回ErrNotHeld
+func (r *ReentrantLock) Unlock() error {
+	return r.release()
+}
+
+// Refresh 将锁的过期时间重新设置为expire
+// 锁已经过期或者被其他client持有返回false,nil
+func (r *ReentrantLock) Refresh() (bool, error) {
+	l := r.lock
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n, err := l.client.eval(rwRefreshScript, []string{l.key}, l.val, l.expire.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// Fence 返回最近一次加锁成功的fencing token
+func (r *ReentrantLock) Fence() int64 {
+	return r.lock.Fence()
+}
+
+// Holds 返回当前实例持有锁的次数
+func (r *ReentrantLock) Holds() int {
+	r.lock.mu.Lock()
+	defer r.lock.mu.Unlock()
+
+	return r.holds
+}
+
+// Lost 返回watchdog续期失败后关闭的chan,没有开启watchdog或者没有获得锁时返回nil
+func (r *ReentrantLock) Lost() <-chan struct{} {
+	return r.lock.Lost()
+}
+
+// acquire 按照mode加锁,第一次加锁成功后开启watchdog
+func (r *ReentrantLock) acquire(mode string) (bool, error) {
+	l := r.lock
+	l.mu.Lock()
+	fence, err := l.client.eval(rwLockScript, []string{l.key, l.fenceKey}, l.val, l.expire.Milliseconds(), mode)
+	if err != nil || fence == 0 {
+		l.mu.Unlock()
+		return false, err
+	}
+
+	l.fence = fence
+	r.holds++
+	first := r.holds == 1
+	l.mu.Unlock()
+
+	if first && l.watchdog {
+		l.wd.start(l.expire/3, r.Refresh)
+	}
+
+	return true, nil
+}
+
+// release 释放一次锁,持有次数为0时停止watchdog
+func (r *ReentrantLock) release() error {
+	l := r.lock
+	l.mu.Lock()
+	n, err := l.client.eval(rwUnlockScript, []string{l.key}, l.val, l.expire.Milliseconds())
+	if err != nil {
+		l.mu.Unlock()
+		return err
+	}
+
+	if n < 0 {
+		n = 0
+		err = ErrNotHeld
+	}
+
+	r.holds = int(n)
+	l.mu.Unlock()
+
+	if n == 0 {
+		l.wd.halt()
+	}
+
+	return err
+}
+
+// RWLock 分布式读写锁,读锁可以被多个持有者同时持有,写锁是排他的可重入锁
+// 同一个持有者不能同时持有读锁和写锁,持有读锁时加写锁会一直失败
+// 持续有读锁加锁时写锁可能一直获取不到
+type RWLock struct {
+	ReentrantLock
+}
+
+// NewRWLock 基于l的redis客户端和option创建读写锁
+// 读写锁使用hash存放,l不能再单独对同一个key加锁
+func NewRWLock(l *Lock) *RWLock {
+	return &RWLock{ReentrantLock{lock: l}}
+}
+
+// TryRLock 尝试加读锁,锁空闲或者被其他持有者加了读锁时返回true,nil
+// 锁被加了写锁返回false,nil
+func (rw *RWLock) TryRLock() (bool, error) {
+	return rw.acquire(modeRead)
+}
+
+// RLock 阻塞加读锁,加锁失败后按照指数退避重试,直到加锁成功或者ctx被取消
+// 加锁成功返回fencing token
+func (rw *RWLock) RLock(ctx context.Context) (int64, error) {
+	if err := retry(ctx, rw.lock.minRetry, rw.lock.maxRetry, rw.TryRLock); err != nil {
+		return 0, err
+	}
+
+	return rw.Fence(), nil
+}
+
+// RUnlock 释放一次读锁,所有读锁释放后删除锁
+// 当前实例没有持有锁时返回ErrNotHeld
+func (rw *RWLock) RUnlock() error {
+	return rw.release()
+}
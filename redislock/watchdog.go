@@ -0,0 +1,101 @@
+package redislock
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// watchdog 定时对锁续期,续期失败后关闭lost
+type watchdog struct {
+	mu   sync.Mutex
+	stop chan struct{} // 停止续期
+	done chan struct{} // 续期的goroutine退出后关闭
+	lost chan struct{} // 续期失败后关闭
+}
+
+// start 开启goroutine每隔interval调用refresh续期,已经开启的续期会先停止
+func (w *watchdog) start(interval time.Duration, refresh func() (bool, error)) {
+	w.halt()
+
+	w.mu.Lock()
+	stop, done, lost := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	w.stop, w.done, w.lost = stop, done, lost
+	w.mu.Unlock()
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if ok, err := refresh(); err != nil || !ok {
+					close(lost)
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// halt 停止续期并等待goroutine退出
+func (w *watchdog) halt() {
+	w.mu.Lock()
+	stop, done := w.stop, w.done
+	w.stop, w.done = nil, nil
+	w.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// lostCh 返回续期失败后关闭的chan,没有开启续期时返回nil
+func (w *watchdog) lostCh() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lost
+}
+
+// retry 调用try直到加锁成功或者ctx被取消,每次失败后等待的时间从min开始翻倍,最大max
+// 实际等待[delay/2,delay]之间的随机时间,避免多个client同时重试
+func retry(ctx context.Context, min, max time.Duration, try func() (bool, error)) error {
+	delay := min
+	var timer *time.Timer
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		if timer == nil {
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+		} else {
+			timer.Reset(wait)
+		}
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if delay *= 2; delay > max {
+			delay = max
+		}
+	}
+}
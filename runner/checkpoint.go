@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/daheige/thinkgo/gfile"
+)
+
+// CheckpointStore 任务执行进度存储接口,记录已经执行成功的任务key
+// 配合WithCheckpoint使用,重新执行时会跳过已经执行成功的任务
+type CheckpointStore interface {
+	// Load 获取job已经执行成功的任务key
+	Load(job string) (map[string]bool, error)
+
+	// Save 记录job执行成功的任务key
+	Save(job string, key string) error
+
+	// Clear 所有任务执行成功后,清除job的执行记录
+	Clear(job string) error
+}
+
+// WithCheckpoint 设置任务执行进度存储,job是任务执行记录的名称
+// Start会跳过已经执行成功的任务,从上一次失败或者中断的地方继续执行
+// 所有任务执行成功后会清除执行记录,下次Start会重新执行所有的任务
+func WithCheckpoint(store CheckpointStore, job string) Option {
+	return func(r *Runner) {
+		r.checkpoint = store
+		r.job = job
+	}
+}
+
+// key 返回任务的key,有名称的任务是名称,否则是task:id
+func (t *task) key() string {
+	if t.name != "" {
+		return t.name
+	}
+
+	return "task:" + strconv.Itoa(t.id)
+}
+
+type idempotencyKey struct{}
+
+// IdempotencyKey 获取当前执行的任务幂等key,格式是job:任务key
+// 任务可以使用它作为写操作的幂等key,防止中断后重新执行时重复写入
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	return key
+}
+
+// FileCheckpoint 基于文件的任务执行进度存储,每个job对应一个文件,每行是一个任务key
+type FileCheckpoint struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileCheckpoint 创建基于文件的任务执行进度存储,执行记录存放在dir目录中
+func NewFileCheckpoint(dir string) *FileCheckpoint {
+	return &FileCheckpoint{
+		dir: dir,
+	}
+}
+
+// filename 返回job执行记录的文件名
+func (f *FileCheckpoint) filename(job string) string {
+	return filepath.Join(f.dir, job+".checkpoint")
+}
+
+// Load 获取job已经执行成功的任务key
+func (f *FileCheckpoint) Load(job string) (map[string]bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make(map[string]bool)
+	filename := f.filename(job)
+	if !gfile.FileExists(filename) {
+		return keys, nil
+	}
+
+	content, err := gfile.FileGetContents(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range strings.Split(content, "\n") {
+		if key != "" {
+			keys[key] = true
+		}
+	}
+
+	return keys, nil
+}
+
+// Save 记录job执行成功的任务key
+func (f *FileCheckpoint) Save(job string, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !gfile.CheckPathExist(f.dir) {
+		if err := os.MkdirAll(f.dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	fd, err := os.OpenFile(f.filename(job), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer fd.Close()
+
+	if _, err = fd.WriteString(key + "\n"); err != nil {
+		return err
+	}
+
+	return fd.Sync()
+}
+
+// Clear 清除job的执行记录
+func (f *FileCheckpoint) Clear(job string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	filename := f.filename(job)
+	if !gfile.FileExists(filename) {
+		return nil
+	}
+
+	return gfile.Unlink(filename)
+}
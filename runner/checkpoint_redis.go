@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisCheckpoint 基于redis set的任务执行进度存储
+// client可以是goredis包创建的redis.Client或者redis.ClusterClient
+type RedisCheckpoint struct {
+	client redis.Cmdable
+	prefix string        // key前缀
+	expire time.Duration // 执行记录过期时间,0表示不过期
+}
+
+// NewRedisCheckpoint 创建基于redis的任务执行进度存储
+// job的执行记录保存在prefix+job的set中,expire是执行记录的过期时间
+func NewRedisCheckpoint(client redis.Cmdable, prefix string, expire time.Duration) *RedisCheckpoint {
+	return &RedisCheckpoint{
+		client: client,
+		prefix: prefix,
+		expire: expire,
+	}
+}
+
+// Load 获取job已经执行成功的任务key
+func (c *RedisCheckpoint) Load(job string) (map[string]bool, error) {
+	members, err := c.client.SMembers(c.prefix + job).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool, len(members))
+	for _, key := range members {
+		keys[key] = true
+	}
+
+	return keys, nil
+}
+
+// Save 记录job执行成功的任务key
+func (c *RedisCheckpoint) Save(job string, key string) error {
+	pipe := c.client.TxPipeline()
+	pipe.SAdd(c.prefix+job, key)
+	if c.expire > 0 {
+		pipe.Expire(c.prefix+job, c.expire)
+	}
+
+	_, err := pipe.Exec()
+	return err
+}
+
+// Clear 清除job的执行记录
+func (c *RedisCheckpoint) Clear(job string) error {
+	return c.client.Del(c.prefix + job).Err()
+}
@@ -0,0 +1,290 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCronSpec cron表达式错误
+var ErrCronSpec = errors.New("invalid cron spec")
+
+// Schedule 任务调度时间接口
+type Schedule interface {
+	// Next 返回t之后下一次执行的时间,如果没有下一次执行时间,返回零值
+	Next(t time.Time) time.Time
+}
+
+// cronSchedule cron表达式调度,每个字段是允许的值的bit集合
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+}
+
+// field cron字段的取值范围
+type field struct {
+	min, max int
+	names    map[string]int
+	sunday   bool // 星期字段,7和0都表示星期天
+}
+
+var (
+	secondField = field{min: 0, max: 59}
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{min: 0, max: 7, sunday: true, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	// starBit 字段是*,用于dom和dow的匹配
+	starBit uint64 = 1 << 63
+
+	// descriptors 预定义的cron表达式
+	descriptors = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+// ParseCron 解析cron表达式,支持5个字段(分 时 日 月 周)和6个字段(秒 分 时 日 月 周)
+// 每个字段支持 * ? , - / 以及月份和星期的英文缩写,比如 */5 1-10/2 MON-FRI
+// 同时支持@yearly,@monthly,@weekly,@daily,@hourly以及@every 1h30m这样的固定间隔
+func ParseCron(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrCronSpec, spec)
+		}
+
+		return Every(d), nil
+	}
+
+	if s, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = s
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("%w: %s,expected 5 or 6 fields", ErrCronSpec, spec)
+	}
+
+	s := &cronSchedule{}
+	var err error
+	for k, f := range []struct {
+		bits *uint64
+		field
+	}{
+		{&s.second, secondField},
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		if *f.bits, err = f.parse(fields[k]); err != nil {
+			return nil, fmt.Errorf("%w: %s,%v", ErrCronSpec, spec, err)
+		}
+	}
+
+	return s, nil
+}
+
+// parse 解析一个字段,返回允许的值的bit集合
+func (f field) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		b, err := f.parsePart(part)
+		if err != nil {
+			return 0, err
+		}
+
+		bits |= b
+	}
+
+	return bits, nil
+}
+
+// parsePart 解析a-b/n格式的表达式
+func (f field) parsePart(part string) (uint64, error) {
+	rangeAndStep := strings.Split(part, "/")
+	if len(rangeAndStep) > 2 {
+		return 0, fmt.Errorf("invalid expr %s", part)
+	}
+
+	var bits uint64
+	start, end, step := f.min, f.max, 1
+	switch r := rangeAndStep[0]; r {
+	case "*", "?":
+		if len(rangeAndStep) == 1 {
+			bits = starBit
+		}
+	default:
+		bounds := strings.Split(r, "-")
+		if len(bounds) > 2 {
+			return 0, fmt.Errorf("invalid range %s", r)
+		}
+
+		var err error
+		if start, err = f.value(bounds[0]); err != nil {
+			return 0, err
+		}
+
+		end = start
+		if len(bounds) == 2 {
+			if end, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+
+			// MON-SUN 范围的结束是星期天时按照7处理
+			if f.sunday && end == 0 && start > 0 {
+				end = 7
+			}
+		} else if len(rangeAndStep) == 2 {
+			// a/n 表示从a开始到最大值每隔n
+			end = f.max
+		}
+	}
+
+	if len(rangeAndStep) == 2 {
+		var err error
+		if step, err = strconv.Atoi(rangeAndStep[1]); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step %s", rangeAndStep[1])
+		}
+	}
+
+	if start > end {
+		return 0, fmt.Errorf("invalid range %s", part)
+	}
+
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+
+	// 展开范围之后再将7转换为星期天0
+	if f.sunday && bits&(1<<7) > 0 {
+		bits = bits&^(1<<7) | 1
+	}
+
+	return bits, nil
+}
+
+// value 解析字段的值,支持英文缩写
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %s", s)
+	}
+
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d,%d]", v, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+// Next 返回t之后下一次执行的时间,按照t的时区计算,最多查找5年,找不到返回零值
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	// 从下一秒开始查找
+	t = t.Add(time.Second - time.Duration(t.Nanosecond())*time.Nanosecond)
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for !has(s.month, int(t.Month())) {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for !has(s.hour, t.Hour()) {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for !has(s.minute, t.Minute()) {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for !has(s.second, t.Second()) {
+		t = t.Truncate(time.Second).Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t
+}
+
+// dayMatches 日和星期的匹配规则和标准cron一样
+// 如果日和星期都不是*,满足其中一个即可,否则需要同时满足
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := has(s.dom, t.Day())
+	dowMatch := has(s.dow, int(t.Weekday()))
+	if s.dom&starBit > 0 || s.dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// has 检查bits中是否包含v
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) > 0
+}
+
+// everySchedule 固定间隔调度
+type everySchedule struct {
+	interval time.Duration
+}
+
+// Every 返回固定间隔d的调度,d最小是1s,不足1s按1s处理
+func Every(d time.Duration) Schedule {
+	if d < time.Second {
+		d = time.Second
+	}
+
+	return everySchedule{interval: d - time.Duration(d.Nanoseconds())%time.Second}
+}
+
+// Next 返回t之后下一次执行的时间,对齐到秒
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(e.interval - time.Duration(t.Nanosecond())*time.Nanosecond)
+}
@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+)
+
+// graph 任务依赖关系图
+type graph struct {
+	indegree   []int    // 每个任务未完成的依赖个数
+	dependents [][]int  // 依赖该任务的任务id
+	failed     []bool   // 依赖的任务是否执行失败
+	ready      *intHeap // 可以执行的任务id,按照id从小到大执行
+}
+
+// newGraph 根据任务依赖关系创建graph,调用之前需要通过checkGraph检查依赖关系
+func newGraph(tasks []*task) *graph {
+	g := &graph{
+		indegree:   make([]int, len(tasks)),
+		dependents: make([][]int, len(tasks)),
+		failed:     make([]bool, len(tasks)),
+		ready:      &intHeap{},
+	}
+
+	names := taskNames(tasks)
+	for _, t := range tasks {
+		for _, dep := range t.deps {
+			id := names[dep]
+			g.dependents[id] = append(g.dependents[id], t.id)
+			g.indegree[t.id]++
+		}
+
+		if g.indegree[t.id] == 0 {
+			heap.Push(g.ready, t.id)
+		}
+	}
+
+	return g
+}
+
+// pop 取出一个可以执行的任务id
+func (g *graph) pop() int {
+	return heap.Pop(g.ready).(int)
+}
+
+// finish 任务完成后,将依赖该任务的任务放入ready中
+// 如果任务执行失败或者被跳过,依赖该任务的任务都会被跳过
+func (g *graph) finish(id int, failed bool) {
+	for _, dep := range g.dependents[id] {
+		if failed {
+			g.failed[dep] = true
+		}
+
+		g.indegree[dep]--
+		if g.indegree[dep] == 0 {
+			heap.Push(g.ready, dep)
+		}
+	}
+}
+
+// taskNames 返回任务名称对应的任务id
+func taskNames(tasks []*task) map[string]int {
+	names := make(map[string]int, len(tasks))
+	for _, t := range tasks {
+		if t.name != "" {
+			names[t.name] = t.id
+		}
+	}
+
+	return names
+}
+
+// checkGraph 检查任务名称是否重复,依赖的任务是否存在,依赖关系是否存在环
+func checkGraph(tasks []*task) error {
+	names := make(map[string]int, len(tasks))
+	for _, t := range tasks {
+		if t.name == "" {
+			continue
+		}
+
+		if _, ok := names[t.name]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateTask, t.name)
+		}
+
+		names[t.name] = t.id
+	}
+
+	indegree := make([]int, len(tasks))
+	dependents := make([][]int, len(tasks))
+	for _, t := range tasks {
+		for _, dep := range t.deps {
+			id, ok := names[dep]
+			if !ok {
+				return fmt.Errorf("%w: %s depends on %s", ErrUnknownTask, t.name, dep)
+			}
+
+			dependents[id] = append(dependents[id], t.id)
+			indegree[t.id]++
+		}
+	}
+
+	// 拓扑排序,排序后剩下的任务存在环
+	queue := make([]int, 0, len(tasks))
+	for id := range tasks {
+		if indegree[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+
+	for i := 0; i < len(queue); i++ {
+		for _, dep := range dependents[queue[i]] {
+			indegree[dep]--
+			if indegree[dep] == 0 {
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	if len(queue) == len(tasks) {
+		return nil
+	}
+
+	cycle := make([]string, 0, len(tasks)-len(queue))
+	for _, t := range tasks {
+		if indegree[t.id] > 0 {
+			cycle = append(cycle, t.name)
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrCycle, strings.Join(cycle, ","))
+}
+
+// intHeap 最小堆,实现heap.Interface
+type intHeap []int
+
+func (h intHeap) Len() int            { return len(h) }
+func (h intHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *intHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+
+func (h *intHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLocked   = errors.New("task is running on another instance")
+	ErrLockLost = errors.New("task lock lost")
+)
+
+// Locker 分布式锁接口,用于多个实例中只有一个实例执行任务
+// redislock.Lock实现了该接口,也可以基于etcd,zookeeper等实现选主
+type Locker interface {
+	// TryLock 尝试加锁,锁被其他实例持有返回false,nil
+	TryLock() (bool, error)
+
+	// Refresh 锁续期,锁已经过期或者被其他实例持有返回false,nil
+	Refresh() (bool, error)
+
+	// Unlock 释放锁,只在获得锁之后任务开始执行之前出错时调用
+	Unlock() error
+}
+
+// WithLocker 设置分布式锁,Start执行任务之前需要先获得锁
+// 任务执行期间每隔renew对锁续期,renew需要小于锁的过期时间,0表示不续期
+// 任务执行完毕后不释放锁,锁在过期后自动释放,避免其他实例稍晚触发同一个周期时重复执行
+// 锁的过期时间需要大于各个实例触发时间的偏差(时钟偏差和jitter),并且小于调度周期
+// 锁被其他实例持有时,Start返回ErrLocked,可以通过WithLockWait等待获得锁
+// 续期失败后会取消正在执行的任务,Start返回ErrLockLost
+func WithLocker(l Locker, renew time.Duration) Option {
+	return func(r *Runner) {
+		r.locker = l
+		r.lockRenew = renew
+	}
+}
+
+// WithLockWait 锁被其他实例持有时,每隔interval重试一次,直到获得锁或者ctx被取消
+func WithLockWait(interval time.Duration) Option {
+	return func(r *Runner) {
+		r.lockWait = interval
+	}
+}
+
+// lock 获得分布式锁,并开启goroutine对锁续期
+// 续期失败后关闭lost,stop停止续期,但是不释放锁
+func (r *Runner) lock(ctx context.Context) (lost <-chan struct{}, stop func(), err error) {
+	for {
+		ok, err := r.locker.TryLock()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if ok {
+			break
+		}
+
+		if r.lockWait <= 0 {
+			return nil, nil, ErrLocked
+		}
+
+		r.logger.Println("task is running on another instance, wait for lock")
+		sleepContext(ctx, r.lockWait)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	lostCh := make(chan struct{})
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if r.lockRenew <= 0 {
+			return
+		}
+
+		ticker := time.NewTicker(r.lockRenew)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ok, err := r.locker.Refresh()
+				if err == nil && ok {
+					continue
+				}
+
+				r.logger.Println("refresh task lock failed: ", err)
+				close(lostCh)
+				return
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(stopCh)
+			<-done
+		})
+	}
+
+	return lostCh, stop, nil
+}
+
+// unlock 释放分布式锁,只在任务开始执行之前出错时调用,让其他实例可以执行
+func (r *Runner) unlock() {
+	if err := r.locker.Unlock(); err != nil {
+		r.logger.Println("unlock task lock error: ", err)
+	}
+}
@@ -1,4 +1,5 @@
-/** Package runner 用于按照顺序，执行程序任务操作，可作为cron作业或定时任务
+/*
+* Package runner 用于按照顺序，执行程序任务操作，可作为cron作业或定时任务
 runner 包可用于展示如何使用通道来监视程序的执行时间,如果程序运行时间太长,指定任务执行时间。
 这个程序可能会作为 cron 作业执行,或者在基于定时任务的云环境(如 iron.io)里执行。
 补充说明：
@@ -13,6 +14,7 @@ runner 包可用于展示如何使用通道来监视程序的执行时间,如果
 package runner
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -23,8 +25,13 @@ import (
 )
 
 var (
-	ErrorTimeout = errors.New("task exec timeout")
-	ErrInterrupt = errors.New("received interrupt signal")
+	ErrorTimeout        = errors.New("task exec timeout")
+	ErrInterrupt        = errors.New("received interrupt signal")
+	ErrDependencyFailed = errors.New("dependency task failed")
+	ErrCycle            = errors.New("task dependency cycle")
+	ErrUnknownTask      = errors.New("unknown dependency task")
+	ErrDuplicateTask    = errors.New("duplicate task name")
+	ErrTaskFailed       = errors.New("task exec failed")
 )
 
 // Logger log interface
@@ -34,14 +41,38 @@ type Logger interface {
 
 // Runner 声明一个runner
 type Runner struct {
-	complete   chan error       // 有缓冲通道，存放所有任务运行后的结果状态
-	tasks      []func() error   // 执行的任务func,如果func没有错误返回，可以返回nil
-	timeout    time.Duration    // 所有的任务超时时间
-	timeCh     <-chan time.Time // 任务超时通道
-	logger     Logger           // 日志输出实例
-	interrupt  chan os.Signal   // 可以控制强制终止的信号
-	allErrors  map[int]error    // 发生错误的task index对应的错误
-	lastTaskId int              // 最后一次完成的任务id
+	tasks       []*task         // 执行的任务,按照添加顺序存放
+	timeout     time.Duration   // 所有的任务超时时间
+	taskTimeout time.Duration   // 每个任务的超时时间
+	logger      Logger          // 日志输出实例
+	interrupt   chan os.Signal  // 可以控制强制终止的信号
+	allErrors   map[int]error   // 发生错误的task index对应的错误
+	lastTaskId  int             // 最后一次完成的任务id
+	concurrency int             // 同时执行的任务个数,默认1
+	result      Result          // 最后一次执行的结果
+	checkpoint  CheckpointStore // 任务执行进度存储
+	job         string          // 任务执行记录的名称
+	resumed     map[string]bool // 之前已经执行成功的任务key
+	locker      Locker          // 分布式锁,多个实例中只有一个实例执行任务
+	lockRenew   time.Duration   // 分布式锁续期间隔
+	lockWait    time.Duration   // 锁被其他实例持有时重试的间隔,0表示不等待
+}
+
+// task 任务定义
+type task struct {
+	id   int                             // 任务id,也就是添加的顺序
+	name string                          // 任务名称,通过Add添加的任务没有名称
+	fn   func(ctx context.Context) error // 执行的任务func,如果func没有错误返回，可以返回nil
+	deps []string                        // 依赖的任务名称,依赖的任务全部执行成功后才执行
+}
+
+// Result 任务执行的结果,存放的是任务id
+type Result struct {
+	Completed  []int // 执行成功的任务
+	Failed     []int // 执行失败的任务
+	Cancelled  []int // 超时或者中断后,返回错误的任务
+	NotStarted []int // 没有开始执行的任务,包括依赖的任务执行失败而跳过的任务
+	Resumed    []int // 之前已经执行成功,从checkpoint恢复而跳过的任务
 }
 
 // Option 采用func Option功能模式为Runner添加参数
@@ -51,7 +82,6 @@ type Option func(r *Runner)
 // 默认创建一个无超时任务的runner
 func New(opts ...Option) *Runner {
 	r := &Runner{
-		complete:  make(chan error, 1),
 		interrupt: make(chan os.Signal, 1), // 声明一个中断信号
 	}
 
@@ -64,6 +94,10 @@ func New(opts ...Option) *Runner {
 		r.logger = log.New(os.Stdout, "", log.LstdFlags)
 	}
 
+	if r.concurrency < 1 {
+		r.concurrency = 1
+	}
+
 	return r
 }
 
@@ -74,6 +108,22 @@ func WithTimeout(t time.Duration) Option {
 	}
 }
 
+// WithTaskTimeout 设置每个任务的超时时间
+// 超时后任务的ctx会被取消,只对通过AddContext,AddTaskContext添加的任务有效
+func WithTaskTimeout(t time.Duration) Option {
+	return func(r *Runner) {
+		r.taskTimeout = t
+	}
+}
+
+// WithConcurrency 设置同时执行的任务个数,默认1
+// 没有依赖关系的任务会并发执行,最多同时执行n个任务
+func WithConcurrency(n int) Option {
+	return func(r *Runner) {
+		r.concurrency = n
+	}
+}
+
 // WithLogger 设置r.logger打印日志的句柄
 func WithLogger(l Logger) Option {
 	return func(r *Runner) {
@@ -82,35 +132,169 @@ func WithLogger(l Logger) Option {
 }
 
 // Add 将需要执行的任务添加到r.tasks队列中
+// 通过Add添加的任务没有依赖,按照添加的顺序执行
 func (r *Runner) Add(tasks ...func() error) {
-	r.tasks = append(r.tasks, tasks...)
+	for _, fn := range tasks {
+		r.AddContext(withoutContext(fn))
+	}
+}
+
+// AddContext 添加接收ctx的任务,超时或者收到中断信号后ctx会被取消
+func (r *Runner) AddContext(tasks ...func(ctx context.Context) error) {
+	for _, fn := range tasks {
+		r.tasks = append(r.tasks, &task{
+			id: len(r.tasks),
+			fn: fn,
+		})
+	}
+}
+
+// AddTask 添加一个有名称的任务,deps是依赖的任务名称
+// 依赖的任务全部执行成功后才会执行该任务,如果依赖的任务执行失败,该任务会被跳过
+// 任务id是添加的顺序,跳过的任务错误是ErrDependencyFailed,可以通过GetAllErrors获取
+func (r *Runner) AddTask(name string, fn func() error, deps ...string) {
+	r.AddTaskContext(name, withoutContext(fn), deps...)
+}
+
+// AddTaskContext 添加一个接收ctx的有名称的任务,deps是依赖的任务名称
+func (r *Runner) AddTaskContext(name string, fn func(ctx context.Context) error, deps ...string) {
+	r.tasks = append(r.tasks, &task{
+		id:   len(r.tasks),
+		name: name,
+		fn:   fn,
+		deps: deps,
+	})
+}
+
+// withoutContext 将不接收ctx的任务转换为接收ctx的任务
+func withoutContext(fn func() error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return fn()
+	}
 }
 
-// run 运行一个个任务,如果出错就返回错误信息
-func (r *Runner) run() (err error) {
-	for k, task := range r.tasks {
-		r.lastTaskId = k
+// task status
+const (
+	statusNotStarted = iota
+	statusCompleted
+	statusFailed
+	statusCancelled
+	statusResumed
+)
+
+// runState 一次执行的状态,run只写入runState,执行完毕后才发布到Runner
+// 避免后台继续执行的任务和调用方同时读写Runner
+type runState struct {
+	errors     map[int]error // 发生错误的task index对应的错误
+	lastTaskId int           // 最后一次开始执行的任务id
+	status     []int         // 每个任务的状态
+}
+
+// run 按照依赖关系运行任务,没有依赖关系的任务最多并发执行r.concurrency个
+// 如果ctx被取消就不再执行新的任务,也不再等待正在执行的任务,它们被记为取消
+func (r *Runner) run(ctx context.Context, st *runState) {
+	g := newGraph(r.tasks)
+
+	type result struct {
+		id  int
+		err error
+	}
+
+	// 容量是r.concurrency,ctx被取消后仍在执行的任务返回时不会阻塞
+	results := make(chan result, r.concurrency)
+	running := make(map[int]struct{}, r.concurrency)
+	finished := 0
+	for finished < len(r.tasks) {
+		for len(running) < r.concurrency && g.ready.Len() > 0 && ctx.Err() == nil {
+			t := r.tasks[g.pop()]
+			if r.resumed[t.key()] {
+				r.logger.Println("current task has completed before: ", t.id)
+				st.status[t.id] = statusResumed
+				g.finish(t.id, false)
+				finished++
+				continue
+			}
+
+			if g.failed[t.id] {
+				r.logger.Println("current task skipped: ", t.id)
+				st.errors[t.id] = fmt.Errorf("task %d %s skipped: %w", t.id, t.name, ErrDependencyFailed)
+				g.finish(t.id, true)
+				finished++
+				continue
+			}
+
+			st.lastTaskId = t.id
+			r.logger.Println("current run task id: ", t.id)
+
+			running[t.id] = struct{}{}
+			go func(t *task) {
+				ctx := context.WithValue(ctx, idempotencyKey{}, r.job+":"+t.key())
+				results <- result{id: t.id, err: r.doTask(ctx, t.fn)}
+			}(t)
+		}
 
-		if r.isInterrupt() {
-			err = ErrInterrupt
+		if len(running) == 0 {
 			return
 		}
 
-		r.logger.Println("current run task id: ", k)
+		var res result
+		select {
+		case res = <-results:
+		case <-ctx.Done():
+			// 不等待没有响应ctx的任务返回,它们在后台继续执行
+			for id := range running {
+				st.errors[id] = ctx.Err()
+				st.status[id] = statusCancelled
+			}
 
-		err = r.doTask(task)
-		if err != nil {
-			r.logger.Println("current task exec occur error: ", err)
-			r.allErrors[k] = err
+			return
+		}
+
+		delete(running, res.id)
+		finished++
+		st.status[res.id] = statusCompleted
+		if res.err != nil {
+			r.logger.Println("current task exec occur error: ", res.err)
+			st.errors[res.id] = res.err
+
+			st.status[res.id] = statusFailed
+			if ctx.Err() != nil {
+				st.status[res.id] = statusCancelled
+			}
+		} else if r.checkpoint != nil {
+			if err := r.checkpoint.Save(r.job, r.tasks[res.id].key()); err != nil {
+				r.logger.Println("save checkpoint error: ", err)
+			}
 		}
+
+		g.finish(res.id, res.err != nil)
 	}
+}
 
-	return
+// newResult 根据任务状态创建Result
+func newResult(status []int) Result {
+	var res Result
+	for id, s := range status {
+		switch s {
+		case statusCompleted:
+			res.Completed = append(res.Completed, id)
+		case statusFailed:
+			res.Failed = append(res.Failed, id)
+		case statusCancelled:
+			res.Cancelled = append(res.Cancelled, id)
+		case statusResumed:
+			res.Resumed = append(res.Resumed, id)
+		default:
+			res.NotStarted = append(res.NotStarted, id)
+		}
+	}
+
+	return res
 }
 
 // doTask 执行每个task，需要捕获每个任务是否出现了panic异常
 // 防止一些个别任务出现了panic,从而导致整个tasks执行全部退出
-func (r *Runner) doTask(task func() error) (err error) {
+func (r *Runner) doTask(ctx context.Context, task func(ctx context.Context) error) (err error) {
 	defer func() {
 		if e := recover(); e != nil {
 			r.logger.Println("current task throw panic: ", e)
@@ -118,11 +302,50 @@ func (r *Runner) doTask(task func() error) (err error) {
 		}
 	}()
 
-	err = task()
+	if r.taskTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.taskTimeout)
+		defer cancel()
+	}
+
+	err = task(ctx)
 
 	return
 }
 
+// resultError 有任务执行失败或者因为依赖的任务失败而跳过时,返回包装了ErrTaskFailed的错误
+// 每个任务的错误可以通过GetAllErrors获取
+func (r *Runner) resultError() error {
+	skipped := 0
+	for _, err := range r.allErrors {
+		if errors.Is(err, ErrDependencyFailed) {
+			skipped++
+		}
+	}
+
+	if len(r.result.Failed) == 0 && skipped == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("%w: %d failed, %d skipped", ErrTaskFailed, len(r.result.Failed), skipped)
+	if len(r.result.Failed) > 0 {
+		err = fmt.Errorf("%w, first error: %v", err, r.allErrors[r.result.Failed[0]])
+	}
+
+	return err
+}
+
+// clearCheckpoint 所有任务执行成功后清除执行记录
+func (r *Runner) clearCheckpoint() {
+	if r.checkpoint == nil || len(r.result.Completed)+len(r.result.Resumed) != len(r.tasks) {
+		return
+	}
+
+	if err := r.checkpoint.Clear(r.job); err != nil {
+		r.logger.Println("clear checkpoint error: ", err)
+	}
+}
+
 // GetAllErrors 获取已经完成任务的error
 func (r *Runner) GetAllErrors() map[int]error {
 	return r.allErrors
@@ -133,21 +356,79 @@ func (r *Runner) GetLastTaskId() int {
 	return r.lastTaskId
 }
 
+// GetResult 获取最后一次执行的结果
+func (r *Runner) GetResult() Result {
+	return r.result
+}
+
 // Start 开始执行所有的任务
+// 如果任务依赖关系存在环,依赖的任务不存在或者任务名称重复,就直接返回错误
 func (r *Runner) Start() error {
+	return r.StartContext(context.Background())
+}
+
+// StartContext 开始执行所有的任务,ctx被取消后不再执行新的任务
+// 超时或者收到中断信号后,正在执行的任务的ctx会被取消,不会等待它们返回
+// 没有响应ctx的任务会在后台继续执行,结果中记为取消
+// 超时返回ErrorTimeout,收到中断信号返回ErrInterrupt,ctx被取消返回ctx.Err()
+// 有任务执行失败或者被跳过时返回包装了ErrTaskFailed的错误
+// 设置了WithLocker时,需要先获得分布式锁,锁被其他实例持有返回ErrLocked,执行完毕后锁在过期后自动释放
+func (r *Runner) StartContext(ctx context.Context) error {
+	if err := checkGraph(r.tasks); err != nil {
+		r.logger.Println("check task dependency error: ", err)
+		return err
+	}
+
+	var lost <-chan struct{}
+	if r.locker != nil {
+		var stop func()
+		var err error
+		if lost, stop, err = r.lock(ctx); err != nil {
+			r.logger.Println("lock task error: ", err)
+			return err
+		}
+
+		// 任务执行完毕后只停止续期,锁在过期后自动释放
+		defer stop()
+	}
+
 	// 接收系统退出信号
 	signal.Notify(r.interrupt, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+	defer signal.Stop(r.interrupt)
 
-	r.allErrors = make(map[int]error, len(r.tasks)+1)
+	r.resumed = nil
+	if r.checkpoint != nil {
+		resumed, err := r.checkpoint.Load(r.job)
+		if err != nil {
+			r.logger.Println("load checkpoint error: ", err)
+			if r.locker != nil {
+				r.unlock()
+			}
 
+			return err
+		}
+
+		r.resumed = resumed
+	}
+
+	var cancel context.CancelFunc
 	if r.timeout > 0 {
-		r.timeCh = time.After(r.timeout)
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
 
+	defer cancel()
+
 	// 执行完毕的信号量
 	done := make(chan struct{}, 1)
 
-	// 开启独立goroutine执行任务
+	// 开启独立goroutine执行任务,执行的状态在done关闭后才发布
+	st := &runState{
+		errors: make(map[int]error, len(r.tasks)+1),
+		status: make([]int, len(r.tasks)),
+	}
+
 	go func() {
 		defer func() {
 			if e := recover(); e != nil {
@@ -157,31 +438,41 @@ func (r *Runner) Start() error {
 			close(done)
 		}()
 
-		r.complete <- r.run()
+		r.run(ctx, st)
 	}()
 
+	var err error
 	select {
-	case <-r.timeCh:
-		r.logger.Println(ErrorTimeout)
-		return ErrorTimeout
 	case <-done:
-		err := <-r.complete
-		r.logger.Println("task complete status: ", err)
-		return err
-	}
-}
-
-// isInterrupt 检查是否接受到操作系统的中断信号
-// 一旦r.interrupt中可以接收值，就会通知Go Runtime停止接收中断信号，然后返回true
-// 这里如果没有default的话，select是会阻塞的，直到r.interrupt可以接收值为止
-func (r *Runner) isInterrupt() bool {
-	select {
+		r.publish(st)
+		r.logger.Println("all task complete")
+		r.clearCheckpoint()
+		return r.resultError()
 	case sg := <-r.interrupt: // 是否接受到操作系统的中断信号
-		signal.Stop(r.interrupt)
 		r.logger.Println("received signal: ", sg.String())
-
-		return true
-	default:
-		return false
+		err = ErrInterrupt
+	case <-lost: // 分布式锁续期失败,其他实例可能已经开始执行
+		err = ErrLockLost
+	case <-ctx.Done():
+		err = ctx.Err()
+		if err == context.DeadlineExceeded {
+			err = ErrorTimeout
+		}
 	}
+
+	r.logger.Println(err)
+
+	// 取消正在执行的任务,run不会等待它们返回
+	cancel()
+	<-done
+	r.publish(st)
+
+	return err
+}
+
+// publish 发布一次执行的状态
+func (r *Runner) publish(st *runState) {
+	r.allErrors = st.errors
+	r.lastTaskId = st.lastTaskId
+	r.result = newResult(st.status)
 }
@@ -1,8 +1,15 @@
 package runner
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -31,6 +38,487 @@ func TestRunner(t *testing.T) {
 	log.Println("all error: ", p.GetAllErrors())
 }
 
+// TestRunnerGraph test task dependency graph
+func TestRunnerGraph(t *testing.T) {
+	std := log.New(os.Stdout, "[runner] ", log.LstdFlags)
+	r := New(WithLogger(std), WithConcurrency(2))
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string, err error) func() error {
+		return func() error {
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return err
+		}
+	}
+
+	errFetch := errors.New("fetch error")
+	r.AddTask("merge", record("merge", nil), "fetchA", "fetchB")
+	r.AddTask("fetchA", record("fetchA", nil))
+	r.AddTask("fetchB", record("fetchB", nil))
+	r.AddTask("fetchC", record("fetchC", errFetch))
+	r.AddTask("report", record("report", nil), "merge", "fetchC")
+	r.AddTask("notify", record("notify", nil), "report")
+
+	begin := time.Now()
+	if err := r.Start(); !errors.Is(err, ErrTaskFailed) || !strings.Contains(err.Error(), "1 failed, 2 skipped") {
+		t.Fatalf("expected %v,got: %v", ErrTaskFailed, err)
+	}
+
+	// fetchA,fetchB,fetchC run concurrently with 2 goroutines.
+	if cost := time.Since(begin); cost >= 40*time.Millisecond {
+		t.Fatalf("expected tasks run concurrently,cost: %v", cost)
+	}
+
+	index := make(map[string]int, len(order))
+	for k, name := range order {
+		index[name] = k
+	}
+
+	if len(order) != 4 || index["merge"] < index["fetchA"] || index["merge"] < index["fetchB"] {
+		t.Fatalf("unexpected exec order: %v", order)
+	}
+
+	errs := r.GetAllErrors()
+	if errs[3] != errFetch || !errors.Is(errs[4], ErrDependencyFailed) || !errors.Is(errs[5], ErrDependencyFailed) {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
+
+// TestRunnerGraphCheck test invalid task dependency
+func TestRunnerGraphCheck(t *testing.T) {
+	fn := func() error { return nil }
+
+	r := New()
+	r.AddTask("a", fn, "c")
+	r.AddTask("b", fn, "a")
+	r.AddTask("c", fn, "b")
+	if err := r.Start(); !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected %v,got: %v", ErrCycle, err)
+	}
+
+	r = New()
+	r.AddTask("a", fn, "d")
+	if err := r.Start(); !errors.Is(err, ErrUnknownTask) {
+		t.Fatalf("expected %v,got: %v", ErrUnknownTask, err)
+	}
+
+	r = New()
+	r.AddTask("a", fn)
+	r.AddTask("a", fn)
+	if err := r.Start(); !errors.Is(err, ErrDuplicateTask) {
+		t.Fatalf("expected %v,got: %v", ErrDuplicateTask, err)
+	}
+}
+
+// TestRunnerCancel test cancel the running tasks when timeout
+func TestRunnerCancel(t *testing.T) {
+	r := New(WithTimeout(50*time.Millisecond), WithTaskTimeout(time.Second), WithConcurrency(2))
+	r.Add(func() error {
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		r.AddContext(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+
+	r.Add(func() error {
+		return nil
+	})
+
+	if err := r.Start(); err != ErrorTimeout {
+		t.Fatalf("expected %v,got: %v", ErrorTimeout, err)
+	}
+
+	res := r.GetResult()
+	if len(res.Completed) != 1 || len(res.Cancelled) != 2 || len(res.NotStarted) != 1 || res.NotStarted[0] != 3 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	// task timeout
+	r = New(WithTaskTimeout(10 * time.Millisecond))
+	r.AddContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := r.Start(); !errors.Is(err, ErrTaskFailed) {
+		t.Fatalf("expected %v,got: %v", ErrTaskFailed, err)
+	}
+
+	if err := r.GetAllErrors()[0]; err != context.DeadlineExceeded {
+		t.Fatalf("expected %v,got: %v", context.DeadlineExceeded, err)
+	}
+
+	if res := r.GetResult(); len(res.Failed) != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+// TestRunnerTimeoutIgnoreContext test Start returns at the deadline when a task ignores ctx
+func TestRunnerTimeoutIgnoreContext(t *testing.T) {
+	r := New(WithTimeout(100 * time.Millisecond))
+	release := make(chan struct{})
+	defer close(release)
+	r.Add(func() error {
+		<-release
+		return nil
+	})
+
+	begin := time.Now()
+	if err := r.Start(); err != ErrorTimeout {
+		t.Fatalf("expected %v,got: %v", ErrorTimeout, err)
+	}
+
+	if cost := time.Since(begin); cost > time.Second {
+		t.Fatalf("start returned after the task,cost: %v", cost)
+	}
+
+	if res := r.GetResult(); len(res.Cancelled) != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if err := r.GetAllErrors()[0]; err != context.DeadlineExceeded {
+		t.Fatalf("expected %v,got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+// TestRunnerCheckpoint test resume tasks from checkpoint
+func TestRunnerCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runner")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	store := NewFileCheckpoint(dir)
+	var cnt [3]int
+	var keys []string
+	fail := true
+	newRunner := func() *Runner {
+		r := New(WithCheckpoint(store, "job"))
+		for i := 0; i < 3; i++ {
+			i := i
+			r.AddContext(func(ctx context.Context) error {
+				cnt[i]++
+				keys = append(keys, IdempotencyKey(ctx))
+				if i == 1 && fail {
+					return errors.New("task error")
+				}
+
+				return nil
+			})
+		}
+
+		return r
+	}
+
+	r := newRunner()
+	if err := r.Start(); !errors.Is(err, ErrTaskFailed) {
+		t.Fatalf("expected %v,got: %v", ErrTaskFailed, err)
+	}
+
+	if res := r.GetResult(); len(res.Failed) != 1 || len(res.Completed) != 2 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	fail = false
+	r = newRunner()
+	if err := r.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+
+	if res := r.GetResult(); len(res.Resumed) != 2 || len(res.Completed) != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if cnt != [3]int{1, 2, 1} || keys[0] != "job:task:0" {
+		t.Fatalf("unexpected exec times: %v,keys: %v", cnt, keys)
+	}
+
+	// the checkpoint is cleared after all tasks completed.
+	if done, err := store.Load("job"); err != nil || len(done) != 0 {
+		t.Fatalf("unexpected checkpoint: %v,error: %v", done, err)
+	}
+}
+
+// TestParseCron test cron spec parse and next run time
+func TestParseCron(t *testing.T) {
+	from := time.Date(2020, 5, 23, 20, 30, 5, 0, time.UTC)
+	for _, c := range []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2020, 5, 23, 20, 45, 0, 0, time.UTC)},
+		{"30 */10 * * * *", time.Date(2020, 5, 23, 20, 30, 30, 0, time.UTC)},
+		{"0 9 * * MON-FRI", time.Date(2020, 5, 25, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, 5, 24, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-7", time.Date(2020, 5, 24, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * MON-SUN", time.Date(2020, 5, 24, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 4-7/3", time.Date(2020, 5, 24, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, 5, 24, 0, 0, 0, 0, time.UTC)},
+		{"@every 1h30m", time.Date(2020, 5, 23, 22, 0, 5, 0, time.UTC)},
+	} {
+		s, err := ParseCron(c.spec)
+		if err != nil {
+			t.Fatalf("parse %s error: %v", c.spec, err)
+		}
+
+		if next := s.Next(from); !next.Equal(c.next) {
+			t.Fatalf("spec %s next run: %v,expected: %v", c.spec, next, c.next)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * * 13 *", "*/0 * * * *", "5-1 * * * *", "* * * * 8", "@every x"} {
+		if _, err := ParseCron(spec); !errors.Is(err, ErrCronSpec) {
+			t.Fatalf("spec %s expected ErrCronSpec,got: %v", spec, err)
+		}
+	}
+}
+
+// TestScheduler test scheduler run jobs
+func TestScheduler(t *testing.T) {
+	std := log.New(os.Stdout, "[scheduler] ", log.LstdFlags)
+	s := NewScheduler(WithSchedulerLogger(std), WithLocation(time.UTC))
+
+	var mu sync.Mutex
+	cnt := 0
+	r := New(WithLogger(std))
+	r.Add(func() error {
+		mu.Lock()
+		cnt++
+		mu.Unlock()
+		return nil
+	})
+
+	if err := s.AddRunner("runner", "@every 1s", r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddRunner("overlap", "@every 1s", r, WithOverlap(OverlapAllow)); !errors.Is(err, ErrRunnerOverlap) {
+		t.Fatalf("expected ErrRunnerOverlap,got: %v", err)
+	}
+
+	if err := s.AddFunc("runner", "* * * * *", nil); !errors.Is(err, ErrDuplicateJob) {
+		t.Fatalf("expected ErrDuplicateJob,got: %v", err)
+	}
+
+	runs, err := s.NextRuns("runner", 3)
+	if err != nil || len(runs) != 3 || runs[1].Sub(runs[0]) != time.Second {
+		t.Fatalf("unexpected next runs: %v,error: %v", runs, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+
+	if err := s.Start(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the interval is aligned to seconds, so it runs 2 or 3 times.
+	if cnt < 2 || cnt > 3 {
+		t.Fatalf("expected 2 or 3 runs,got: %d", cnt)
+	}
+
+	if entries := s.Entries(); len(entries) != 1 || entries[0].Prev.IsZero() || !entries[0].Next.IsZero() {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+// TestSchedulerOverlap test overlap policy
+func TestSchedulerOverlap(t *testing.T) {
+	s := NewScheduler(WithSchedulerLogger(log.New(ioutil.Discard, "", 0)))
+	release := make(chan struct{})
+	var mu sync.Mutex
+	cnt := make(map[string]int)
+	job := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			<-release
+			mu.Lock()
+			cnt[name]++
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	ctx := context.Background()
+	for _, policy := range []OverlapPolicy{OverlapSkip, OverlapQueue, OverlapAllow} {
+		name := fmt.Sprint(policy)
+		if err := s.AddSchedule(name, Every(time.Hour), job(name), WithOverlap(policy)); err != nil {
+			t.Fatal(err)
+		}
+
+		// trigger 3 times while the first run is blocked.
+		s.mu.Lock()
+		for i := 0; i < 3; i++ {
+			s.trigger(ctx, s.names[name])
+		}
+
+		s.mu.Unlock()
+	}
+
+	entries := s.Entries()
+	if entries[0].Running != 1 || entries[1].Running != 1 || entries[1].Queued != 2 || entries[2].Running != 3 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	close(release)
+	s.wg.Wait()
+
+	if cnt["0"] != 1 || cnt["1"] != 3 || cnt["2"] != 3 {
+		t.Fatalf("unexpected exec times: %v", cnt)
+	}
+}
+
+// memLock 内存中的锁,多个memLocker共享
+type memLock struct {
+	mu     sync.Mutex
+	holder string    // 当前持有锁的实例
+	expire time.Time // 锁的过期时间
+}
+
+func (m *memLock) held() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Now().After(m.expire) {
+		return ""
+	}
+
+	return m.holder
+}
+
+// memLocker 内存实现的Locker,锁在ttl之后过期
+type memLocker struct {
+	lock    *memLock
+	name    string
+	ttl     time.Duration
+	refresh bool // Refresh是否成功
+}
+
+func (l *memLocker) TryLock() (bool, error) {
+	l.lock.mu.Lock()
+	defer l.lock.mu.Unlock()
+	if l.lock.holder != "" && time.Now().Before(l.lock.expire) {
+		return false, nil
+	}
+
+	l.lock.holder = l.name
+	l.lock.expire = time.Now().Add(l.ttl)
+	return true, nil
+}
+
+func (l *memLocker) Refresh() (bool, error) {
+	l.lock.mu.Lock()
+	defer l.lock.mu.Unlock()
+	if !l.refresh || l.lock.holder != l.name || time.Now().After(l.lock.expire) {
+		return false, nil
+	}
+
+	l.lock.expire = time.Now().Add(l.ttl)
+	return true, nil
+}
+
+func (l *memLocker) Unlock() error {
+	l.lock.mu.Lock()
+	defer l.lock.mu.Unlock()
+	if l.lock.holder == l.name {
+		l.lock.holder = ""
+	}
+
+	return nil
+}
+
+// TestRunnerLocker test distributed lock
+func TestRunnerLocker(t *testing.T) {
+	std := log.New(os.Stdout, "[runner] ", log.LstdFlags)
+	lock := &memLock{holder: "other", expire: time.Now().Add(50 * time.Millisecond)}
+	locker := &memLocker{lock: lock, name: "a", ttl: 200 * time.Millisecond, refresh: true}
+	var cnt int32
+	task := func(ctx context.Context) error {
+		atomic.AddInt32(&cnt, 1)
+		select {
+		case <-time.After(100 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// skip when another instance holds the lock.
+	r := New(WithLogger(std), WithLocker(locker, 20*time.Millisecond))
+	r.AddContext(task)
+	if err := r.Start(); err != ErrLocked || atomic.LoadInt32(&cnt) != 0 {
+		t.Fatalf("expected ErrLocked,got: %v,exec times: %d", err, cnt)
+	}
+
+	// wait for the lock until it expires.
+	r = New(WithLogger(std), WithLocker(locker, 20*time.Millisecond), WithLockWait(10*time.Millisecond))
+	r.AddContext(task)
+	if err := r.Start(); err != nil || atomic.LoadInt32(&cnt) != 1 {
+		t.Fatalf("unexpected error: %v,exec times: %d", err, cnt)
+	}
+
+	// the lock is kept until it expires after all tasks completed.
+	if holder := lock.held(); holder != "a" {
+		t.Fatalf("lock is released,holder: %s", holder)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+
+	// cancel the running tasks after the lock lost.
+	locker.refresh = false
+	if err := r.Start(); err != ErrLockLost {
+		t.Fatalf("expected ErrLockLost,got: %v", err)
+	}
+
+	if res := r.GetResult(); len(res.Cancelled) != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+// TestRunnerLockerTick 测试两个实例相差一个tick触发同一个周期时只执行一次
+func TestRunnerLockerTick(t *testing.T) {
+	std := log.New(os.Stdout, "[runner] ", log.LstdFlags)
+	lock := &memLock{}
+	var cnt int32
+	task := func() error {
+		atomic.AddInt32(&cnt, 1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	start := func(name string) error {
+		r := New(WithLogger(std), WithLocker(&memLocker{lock: lock, name: name, ttl: 200 * time.Millisecond, refresh: true}, 50*time.Millisecond))
+		r.Add(task)
+		return r.Start()
+	}
+
+	if err := start("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// b fires the same tick after a completed.
+	time.Sleep(20 * time.Millisecond)
+	if err := start("b"); err != ErrLocked || atomic.LoadInt32(&cnt) != 1 {
+		t.Fatalf("expected ErrLocked,got: %v,exec times: %d", err, cnt)
+	}
+
+	// the next tick runs after the lock expired.
+	time.Sleep(200 * time.Millisecond)
+	if err := start("b"); err != nil || atomic.LoadInt32(&cnt) != 2 {
+		t.Fatalf("unexpected error: %v,exec times: %d", err, cnt)
+	}
+}
+
 // createTask 创建任务
 func createTask(id int) func() error {
 	return func() error {
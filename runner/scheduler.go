@@ -0,0 +1,438 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/daheige/thinkgo/gtime"
+)
+
+var (
+	ErrDuplicateJob     = errors.New("duplicate schedule job name")
+	ErrUnknownJob       = errors.New("unknown schedule job")
+	ErrSchedulerRunning = errors.New("scheduler is already running")
+	ErrRunnerOverlap    = errors.New("runner can not run overlapped")
+)
+
+// OverlapPolicy 上一次执行还没有结束,又到了执行时间的处理策略
+type OverlapPolicy int
+
+const (
+	// OverlapSkip 跳过本次执行,默认策略
+	OverlapSkip OverlapPolicy = iota
+
+	// OverlapQueue 本次执行排队,上一次执行结束后立即执行
+	OverlapQueue
+
+	// OverlapAllow 允许同时执行
+	OverlapAllow
+)
+
+// Scheduler 定时任务调度器,按照cron表达式或者固定间隔执行任务
+type Scheduler struct {
+	loc     *time.Location // 计算执行时间的时区
+	logger  Logger         // 日志输出实例
+	mu      sync.Mutex
+	entries []*entry          // 调度的任务,按照添加顺序存放
+	names   map[string]*entry // 任务名称对应的任务
+	wake    chan struct{}     // 添加或者删除任务后,重新计算下一次执行时间
+	running bool              // 是否已经开始调度
+	wg      sync.WaitGroup    // 正在执行的任务
+	now     func() time.Time  // 当前时间
+}
+
+// entry 调度的任务
+type entry struct {
+	name     string
+	spec     string
+	schedule Schedule
+	fn       func(ctx context.Context) error
+	overlap  OverlapPolicy
+	jitter   time.Duration
+	prev     time.Time // 上一次执行时间
+	next     time.Time // 下一次执行时间
+	running  int       // 正在执行的个数
+	queued   int       // 排队等待执行的个数
+}
+
+// Entry 调度任务的状态,用于查看任务的执行情况
+type Entry struct {
+	Name    string
+	Spec    string
+	Prev    time.Time // 上一次执行时间,没有执行过是零值
+	Next    time.Time // 下一次执行时间,没有开始调度或者没有下一次执行时间是零值
+	Running int       // 正在执行的个数
+	Queued  int       // 排队等待执行的个数
+}
+
+// SchedulerOption 采用func Option功能模式为Scheduler添加参数
+type SchedulerOption func(s *Scheduler)
+
+// JobOption 调度任务的参数
+type JobOption func(e *entry)
+
+// NewScheduler 创建一个定时任务调度器,默认使用gtime.TimeZone时区
+func NewScheduler(opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		names: make(map[string]*entry),
+		wake:  make(chan struct{}, 1),
+		now:   time.Now,
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	if s.logger == nil {
+		s.logger = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	if s.loc == nil {
+		loc, err := time.LoadLocation(gtime.TimeZone)
+		if err != nil {
+			s.logger.Println("load time zone error: ", err)
+			loc = time.Local
+		}
+
+		s.loc = loc
+	}
+
+	return s
+}
+
+// WithLocation 设置计算执行时间的时区
+func WithLocation(loc *time.Location) SchedulerOption {
+	return func(s *Scheduler) {
+		s.loc = loc
+	}
+}
+
+// WithSchedulerLogger 设置s.logger打印日志的句柄
+func WithSchedulerLogger(l Logger) SchedulerOption {
+	return func(s *Scheduler) {
+		s.logger = l
+	}
+}
+
+// WithOverlap 设置上一次执行还没有结束时的处理策略,默认OverlapSkip
+func WithOverlap(policy OverlapPolicy) JobOption {
+	return func(e *entry) {
+		e.overlap = policy
+	}
+}
+
+// WithJitter 每次执行前随机等待[0,d)的时间,避免多个任务同时执行
+func WithJitter(d time.Duration) JobOption {
+	return func(e *entry) {
+		e.jitter = d
+	}
+}
+
+// AddFunc 添加一个按照spec调度的任务,spec格式参考ParseCron
+// 调度器停止后,正在执行的任务的ctx会被取消
+func (s *Scheduler) AddFunc(name string, spec string, fn func(ctx context.Context) error, opts ...JobOption) error {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+
+	return s.add(name, spec, schedule, fn, opts...)
+}
+
+// AddRunner 添加一个按照spec调度的Runner,每次执行调用r.StartContext
+// 同一个Runner不能同时执行,设置OverlapAllow会返回ErrRunnerOverlap
+// 需要同时执行时,可以使用AddFunc在每次执行时创建新的Runner
+func (s *Scheduler) AddRunner(name string, spec string, r *Runner, opts ...JobOption) error {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+
+	e := &entry{}
+	for _, o := range opts {
+		o(e)
+	}
+
+	if e.overlap == OverlapAllow {
+		return fmt.Errorf("%w: %s", ErrRunnerOverlap, name)
+	}
+
+	return s.add(name, spec, schedule, r.StartContext, opts...)
+}
+
+// AddSchedule 添加一个按照自定义Schedule调度的任务
+func (s *Scheduler) AddSchedule(name string, schedule Schedule, fn func(ctx context.Context) error, opts ...JobOption) error {
+	return s.add(name, "", schedule, fn, opts...)
+}
+
+// add 添加调度任务,如果调度器已经开始,计算下一次执行时间并唤醒调度器
+func (s *Scheduler) add(name string, spec string, schedule Schedule, fn func(ctx context.Context) error, opts ...JobOption) error {
+	e := &entry{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		fn:       fn,
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.names[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, name)
+	}
+
+	s.entries = append(s.entries, e)
+	s.names[name] = e
+	if s.running {
+		e.next = e.schedule.Next(s.now().In(s.loc))
+		s.notify()
+	}
+
+	return nil
+}
+
+// Remove 删除调度任务,正在执行的任务不受影响,排队的执行会被取消
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.names[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+
+	delete(s.names, name)
+	for k, v := range s.entries {
+		if v == e {
+			s.entries = append(s.entries[:k], s.entries[k+1:]...)
+			break
+		}
+	}
+
+	e.queued = 0
+	s.notify()
+
+	return nil
+}
+
+// notify 唤醒调度器重新计算下一次执行时间
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Entries 返回所有调度任务的状态,按照添加顺序排列
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, Entry{
+			Name:    e.name,
+			Spec:    e.spec,
+			Prev:    e.prev,
+			Next:    e.next,
+			Running: e.running,
+			Queued:  e.queued,
+		})
+	}
+
+	return entries
+}
+
+// NextRuns 返回任务接下来n次的执行时间,时间的时区是调度器的时区
+func (s *Scheduler) NextRuns(name string, n int) ([]time.Time, error) {
+	s.mu.Lock()
+	e, ok := s.names[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+
+	runs := make([]time.Time, 0, n)
+	t := s.now().In(s.loc)
+	for i := 0; i < n; i++ {
+		t = e.schedule.Next(t)
+		if t.IsZero() {
+			break
+		}
+
+		runs = append(runs, t)
+	}
+
+	return runs, nil
+}
+
+// Start 开始调度任务,直到ctx被取消
+// ctx被取消后,正在执行的任务的ctx也会被取消,等待它们返回后才会返回
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return ErrSchedulerRunning
+	}
+
+	s.running = true
+	now := s.now().In(s.loc)
+	for _, e := range s.entries {
+		e.next = e.schedule.Next(now)
+	}
+
+	s.mu.Unlock()
+
+	defer func() {
+		s.wg.Wait()
+
+		s.mu.Lock()
+		s.running = false
+		for _, e := range s.entries {
+			e.next = time.Time{}
+			e.queued = 0
+		}
+
+		s.mu.Unlock()
+	}()
+
+	for {
+		// 没有需要执行的任务时,等待添加任务
+		var timer *time.Timer
+		var next <-chan time.Time
+		if d, ok := s.nextDelay(); ok {
+			timer = time.NewTimer(d)
+			next = timer.C
+		}
+
+		select {
+		case <-next:
+			s.runDue(ctx)
+		case <-s.wake:
+		case <-ctx.Done():
+			s.logger.Println("scheduler stopped: ", ctx.Err())
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// nextDelay 返回距离最近一次执行的时间
+func (s *Scheduler) nextDelay() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, e := range s.entries {
+		if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+			next = e.next
+		}
+	}
+
+	if next.IsZero() {
+		return 0, false
+	}
+
+	return next.Sub(s.now()), true
+}
+
+// runDue 执行已经到了执行时间的任务,并计算下一次执行时间
+func (s *Scheduler) runDue(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().In(s.loc)
+	for _, e := range s.entries {
+		if e.next.IsZero() || e.next.After(now) {
+			continue
+		}
+
+		e.prev = e.next
+		e.next = e.schedule.Next(now)
+		s.trigger(ctx, e)
+	}
+}
+
+// trigger 根据OverlapPolicy执行任务,调用之前需要持有s.mu
+func (s *Scheduler) trigger(ctx context.Context, e *entry) {
+	if e.running > 0 {
+		switch e.overlap {
+		case OverlapSkip:
+			s.logger.Println("schedule job is running, skipped: ", e.name)
+			return
+		case OverlapQueue:
+			e.queued++
+			return
+		}
+	}
+
+	e.running++
+	s.wg.Add(1)
+	go s.run(ctx, e)
+}
+
+// run 执行任务,执行结束后继续执行排队的任务
+func (s *Scheduler) run(ctx context.Context, e *entry) {
+	defer s.wg.Done()
+
+	for {
+		if e.jitter > 0 {
+			sleepContext(ctx, time.Duration(rand.Int63n(int64(e.jitter))))
+		}
+
+		if ctx.Err() == nil {
+			if err := s.exec(ctx, e); err != nil {
+				s.logger.Println("schedule job exec error: ", e.name, err)
+			}
+		}
+
+		s.mu.Lock()
+		if e.queued > 0 && ctx.Err() == nil {
+			e.queued--
+			s.mu.Unlock()
+			continue
+		}
+
+		e.running--
+		s.mu.Unlock()
+		return
+	}
+}
+
+// exec 执行一次任务,捕获任务的panic
+func (s *Scheduler) exec(ctx context.Context, e *entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("schedule job panic: %v", r)
+		}
+	}()
+
+	return e.fn(ctx)
+}
+
+// sleepContext 等待d或者ctx被取消
+func sleepContext(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
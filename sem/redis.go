@@ -0,0 +1,252 @@
+package sem
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/gomodule/redigo/redis"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrLeaseExpired 续期时ticket已经过期,被其他实例获取
+var ErrLeaseExpired = errors.New("semaphore: ticket lease expired")
+
+// acquireSrc lua脚本获取一个ticket,先清除过期的ticket,再检查ticket是否用完
+// ticket存放在sorted set中,member是ticket的token,score是过期时间(毫秒)
+// key的过期时间设置为最晚过期的ticket的过期时间,租期较短的ticket不会让其他ticket提前过期
+var acquireSrc = `
+redis.call("zremrangebyscore", KEYS[1], "-inf", ARGV[1])
+if redis.call("zcard", KEYS[1]) < tonumber(ARGV[4]) then
+	redis.call("zadd", KEYS[1], ARGV[2], ARGV[3])
+	redis.call("pexpireat", KEYS[1], redis.call("zrange", KEYS[1], -1, -1, "withscores")[2])
+	return 1
+end
+return 0`
+
+// refreshSrc lua脚本续期一个ticket,ticket已经过期或者被清除返回0
+var refreshSrc = `
+if redis.call("zscore", KEYS[1], ARGV[2]) then
+	redis.call("zadd", KEYS[1], ARGV[1], ARGV[2])
+	redis.call("pexpireat", KEYS[1], redis.call("zrange", KEYS[1], -1, -1, "withscores")[2])
+	return 1
+end
+return 0`
+
+// releaseSrc lua脚本释放一个ticket
+var releaseSrc = `return redis.call("zrem", KEYS[1], ARGV[1])`
+
+// script 同时支持redigo和go-redis的lua脚本
+type script struct {
+	redigo  *redis.Script
+	goredis *goredis.Script
+}
+
+func newScript(src string) *script {
+	return &script{
+		redigo:  redis.NewScript(1, src),
+		goredis: goredis.NewScript(src),
+	}
+}
+
+var (
+	acquireScript = newScript(acquireSrc)
+	refreshScript = newScript(refreshSrc)
+	releaseScript = newScript(releaseSrc)
+)
+
+// evaler 执行lua脚本,返回整数结果
+type evaler interface {
+	eval(s *script, key string, args ...interface{}) (int64, error)
+}
+
+// redigoEvaler 基于redigo连接池执行lua脚本
+type redigoEvaler struct {
+	pool *redis.Pool
+}
+
+func (e redigoEvaler) eval(s *script, key string, args ...interface{}) (int64, error) {
+	conn := e.pool.Get()
+	defer conn.Close()
+
+	return redis.Int64(s.redigo.Do(conn, append([]interface{}{key}, args...)...))
+}
+
+// goredisEvaler 基于go-redis client执行lua脚本
+type goredisEvaler struct {
+	client goredis.Cmdable
+}
+
+func (e goredisEvaler) eval(s *script, key string, args ...interface{}) (int64, error) {
+	return s.goredis.Run(e.client, []string{key}, args...).Int64()
+}
+
+// RedisSemaphore 基于redis的分布式信号量,实现了SemInterface
+// 所有实例使用相同的key共享tickets个ticket,每个ticket有一个租期
+// 获取ticket的实例崩溃后,ticket在租期结束后自动释放
+// 租期的过期时间是实例的本地时间计算的,各个实例的时间需要保持同步
+type RedisSemaphore struct {
+	client   evaler
+	key      string        // 存放ticket的sorted set key
+	tickets  int           // ticket总数
+	timeout  time.Duration // acquire timeout
+	lease    time.Duration // ticket租期
+	interval time.Duration // ticket用完时重试的间隔
+	mu       sync.Mutex
+	tokens   []string // 当前实例获取的ticket
+}
+
+// RedisOption 采用func Option功能模式为RedisSemaphore添加参数
+type RedisOption func(s *RedisSemaphore)
+
+// WithLease 设置ticket的租期,默认30s,持有ticket超过租期需要调用Refresh续期
+func WithLease(d time.Duration) RedisOption {
+	return func(s *RedisSemaphore) {
+		s.lease = d
+	}
+}
+
+// WithRetryInterval 设置ticket用完时重试获取的间隔,默认50ms
+func WithRetryInterval(d time.Duration) RedisOption {
+	return func(s *RedisSemaphore) {
+		s.interval = d
+	}
+}
+
+// NewRedis 创建基于redigo连接池的分布式信号量,pool可以是gredigo.NewRedisPool创建的连接池
+func NewRedis(pool *redis.Pool, key string, tickets int, timeout time.Duration, opts ...RedisOption) *RedisSemaphore {
+	return newRedisSemaphore(redigoEvaler{pool: pool}, key, tickets, timeout, opts...)
+}
+
+// NewGoRedis 创建基于go-redis的分布式信号量
+// client可以是goredis包创建的redis.Client或者redis.ClusterClient
+func NewGoRedis(client goredis.Cmdable, key string, tickets int, timeout time.Duration, opts ...RedisOption) *RedisSemaphore {
+	return newRedisSemaphore(goredisEvaler{client: client}, key, tickets, timeout, opts...)
+}
+
+func newRedisSemaphore(client evaler, key string, tickets int, timeout time.Duration, opts ...RedisOption) *RedisSemaphore {
+	s := &RedisSemaphore{
+		client:   client,
+		key:      key,
+		tickets:  tickets,
+		timeout:  timeout,
+		lease:    30 * time.Second,
+		interval: 50 * time.Millisecond,
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	return s
+}
+
+// Acquire 获取一个ticket,timeout后返回ErrNoTickets
+func (s *RedisSemaphore) Acquire() error {
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	err := s.AcquireContext(ctx)
+	if err == context.DeadlineExceeded {
+		return ErrNoTickets
+	}
+
+	return err
+}
+
+// AcquireContext 获取一个ticket,ticket用完时每隔一段时间重试,直到获取成功或者ctx被取消
+// ctx没有设置过期时间并且ticket用完时,直接返回ErrNoTickets
+func (s *RedisSemaphore) AcquireContext(ctx context.Context) error {
+	token := uuid.NewV4().String()
+	var timer *time.Timer
+	for {
+		now := time.Now()
+		ok, err := s.client.eval(acquireScript, s.key, now.UnixMilli(), now.Add(s.lease).UnixMilli(), token, s.tickets)
+		if err != nil {
+			return err
+		}
+
+		if ok == 1 {
+			s.mu.Lock()
+			s.tokens = append(s.tokens, token)
+			s.mu.Unlock()
+			return nil
+		}
+
+		if ctx.Done() == nil {
+			return ErrNoTickets
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(s.interval)
+			defer timer.Stop()
+		} else {
+			timer.Reset(s.interval)
+		}
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release 释放当前实例获取的一个ticket,当前实例没有获取ticket返回ErrIllegalRelease
+func (s *RedisSemaphore) Release() error {
+	s.mu.Lock()
+	if len(s.tokens) == 0 {
+		s.mu.Unlock()
+		return ErrIllegalRelease
+	}
+
+	token := s.tokens[0]
+	s.tokens = s.tokens[1:]
+	s.mu.Unlock()
+
+	_, err := s.client.eval(releaseScript, s.key, token)
+	return err
+}
+
+// Refresh 将当前实例获取的所有ticket续期一个租期
+// 有ticket已经过期时,不再持有该ticket,返回ErrLeaseExpired
+func (s *RedisSemaphore) Refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	tokens := s.tokens[:0]
+	for _, token := range s.tokens {
+		expireAt := time.Now().Add(s.lease).UnixMilli()
+		ok, e := s.client.eval(refreshScript, s.key, expireAt, token)
+		if e != nil {
+			// 续期出错时保留ticket,下次继续续期
+			tokens = append(tokens, token)
+			err = e
+			continue
+		}
+
+		if ok == 1 {
+			tokens = append(tokens, token)
+		} else if err == nil {
+			err = ErrLeaseExpired
+		}
+	}
+
+	s.tokens = tokens
+	return err
+}
+
+// Held 返回当前实例持有的ticket个数
+func (s *RedisSemaphore) Held() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.tokens)
+}
@@ -0,0 +1,118 @@
+package sem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis"
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestRedisSemaphore(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mr.Close()
+
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", mr.Addr())
+		},
+	}
+
+	defer pool.Close()
+
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	// two instances share 2 tickets.
+	a := NewRedis(pool, "sem:api", 2, 0, WithLease(time.Second))
+	b := NewGoRedis(client, "sem:api", 2, 30*time.Millisecond, WithRetryInterval(5*time.Millisecond))
+	var _ SemInterface = a
+
+	if err := a.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Acquire(); err != ErrNoTickets {
+		t.Fatalf("expected ErrNoTickets,got: %v", err)
+	}
+
+	if err := b.Acquire(); err != ErrNoTickets {
+		t.Fatalf("expected ErrNoTickets,got: %v", err)
+	}
+
+	if err := b.Release(); err != nil || b.Held() != 0 {
+		t.Fatalf("unexpected error: %v,held: %d", err, b.Held())
+	}
+
+	if err := b.Release(); err != ErrIllegalRelease {
+		t.Fatalf("expected ErrIllegalRelease,got: %v", err)
+	}
+
+	// the ticket of a crashed holder is released after the lease.
+	crashed := NewRedis(pool, "sem:api", 2, 0, WithLease(50*time.Millisecond))
+	if err := crashed.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := b.Acquire(); err != nil {
+		t.Fatalf("expected acquire after lease expired,got: %v", err)
+	}
+
+	if err := crashed.Refresh(); err != ErrLeaseExpired || crashed.Held() != 0 {
+		t.Fatalf("expected ErrLeaseExpired,got: %v", err)
+	}
+
+	if err := a.Refresh(); err != nil || a.Held() != 1 {
+		t.Fatalf("unexpected error: %v,held: %d", err, a.Held())
+	}
+
+	if err := a.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a short lease must not shorten the ttl of the whole ticket set.
+	long := NewRedis(pool, "sem:api", 2, 0, WithLease(30*time.Second))
+	short := NewRedis(pool, "sem:api", 2, 0, WithLease(100*time.Millisecond))
+	if err := long.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := short.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the score of the short ticket expires in local time,the key ttl in redis time.
+	time.Sleep(110 * time.Millisecond)
+	mr.FastForward(200 * time.Millisecond)
+	if !mr.Exists("sem:api") {
+		t.Fatal("the ticket set is expired with a live ticket")
+	}
+
+	if err := long.Refresh(); err != nil || long.Held() != 1 {
+		t.Fatalf("unexpected error: %v,held: %d", err, long.Held())
+	}
+
+	c := NewRedis(pool, "sem:api", 2, 0)
+	d := NewRedis(pool, "sem:api", 2, 0)
+	if err := c.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Acquire(); err != ErrNoTickets {
+		t.Fatalf("expected ErrNoTickets,got: %v", err)
+	}
+}
@@ -1,12 +1,13 @@
 package sem
 
-// 指定数量的空结构体缓存通道，实现信息号实现互斥锁
-// Mutually exclusive by channel semaphore
+// 基于带权重的信号量Weighted实现指定数量ticket的互斥锁,等待获取的请求按照先进先出的顺序满足
+// Mutually exclusive by weighted semaphore with fifo waiters
 // A semaphore is a synchronization pattern/primitive
 // that imposes mutual exclusion on a limited number of resources.
 // 信号量是同步模式/原语，它在有限数量的资源上强加互斥
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -14,6 +15,7 @@ import (
 var (
 	ErrNoTickets      = errors.New("semaphore: could not aquire semaphore")
 	ErrIllegalRelease = errors.New("semaphore: can't release the semaphore without acquiring it first")
+	ErrInvalidWeight  = errors.New("semaphore: weight must be positive")
 )
 
 // SemInterface contains the behavior of a semaphore that can be acquired and/or released.
@@ -25,35 +27,40 @@ type SemInterface interface {
 
 // sem define
 type semaphore struct {
-	sem     chan struct{}
-	timeout time.Duration // acquire/release timeout
+	w       *Weighted
+	timeout time.Duration // acquire timeout
 }
 
 // New create semaphonre mutex lock with timeout,tickets: a limited number of resources
+// 需要获取多个ticket或者通过ctx控制等待时间时,使用NewWeighted
 func New(tickets int, timeout time.Duration) SemInterface {
 	return &semaphore{
-		sem:     make(chan struct{}, tickets),
+		w:       NewWeighted(int64(tickets)),
 		timeout: timeout,
 	}
 }
 
-// Acquire get a sem
+// Acquire get a sem,timeout后返回ErrNoTickets
 func (s *semaphore) Acquire() error {
-	select {
-	case s.sem <- struct{}{}:
+	if s.w.TryAcquire(1) {
 		return nil
-	case <-time.After(s.timeout):
+	}
+
+	if s.timeout <= 0 {
 		return ErrNoTickets
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if err := s.w.Acquire(ctx, 1); err != nil {
+		return ErrNoTickets
+	}
+
+	return nil
 }
 
-// Release release sem
+// Release release sem,没有获取就释放返回ErrIllegalRelease
 func (s *semaphore) Release() error {
-	t := time.After(s.timeout)
-	select {
-	case <-s.sem:
-		return nil
-	case <-t: // release error
-		return ErrIllegalRelease
-	}
+	return s.w.Release(1)
 }
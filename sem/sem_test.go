@@ -1,6 +1,7 @@
 package sem
 
 import (
+	"context"
 	"log"
 	"os"
 	"sync"
@@ -8,6 +9,89 @@ import (
 	"time"
 )
 
+// TestWeighted 需要放在TestSemWithTimeout前面,它最后会调用os.Exit
+func TestWeighted(t *testing.T) {
+	s := NewWeighted(3)
+	if err := s.Acquire(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.TryAcquire(2) || !s.TryAcquire(1) || s.Current() != 3 {
+		t.Fatalf("unexpected current: %d", s.Current())
+	}
+
+	// a large request waits at the front of the queue,the small one waits behind it.
+	large := make(chan error, 1)
+	go func() {
+		large <- s.Acquire(context.Background(), 3)
+	}()
+
+	for s.Waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	small := make(chan error, 1)
+	go func() {
+		small <- s.Acquire(context.Background(), 1)
+	}()
+
+	for s.Waiting() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	s.Release(1)
+	if s.TryAcquire(1) {
+		t.Fatal("TryAcquire should fail when there are waiters")
+	}
+
+	s.Release(2)
+	if err := <-large; err != nil || s.Current() != 3 {
+		t.Fatalf("unexpected error: %v,current: %d", err, s.Current())
+	}
+
+	// resize to let the small request acquire.
+	s.Resize(4)
+	if err := <-small; err != nil || s.Current() != 4 || s.Size() != 4 {
+		t.Fatalf("unexpected error: %v,current: %d", err, s.Current())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(ctx, 1); err != context.DeadlineExceeded || s.Waiting() != 0 {
+		t.Fatalf("expected context.DeadlineExceeded,got: %v", err)
+	}
+
+	if err := s.Release(5); err != ErrIllegalRelease {
+		t.Fatalf("expected ErrIllegalRelease,got: %v", err)
+	}
+
+	if err := s.Release(-1); err != ErrInvalidWeight || s.Current() != 4 {
+		t.Fatalf("expected ErrInvalidWeight,got: %v", err)
+	}
+
+	if err := s.Acquire(context.Background(), 0); err != ErrInvalidWeight || s.TryAcquire(-1) {
+		t.Fatalf("expected ErrInvalidWeight,got: %v", err)
+	}
+
+	// a request larger than the size does not block the following requests.
+	s.Release(4)
+	ctx, cancel = context.WithCancel(context.Background())
+	oversize := make(chan error, 1)
+	go func() {
+		oversize <- s.Acquire(ctx, 5)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := s.Acquire(context.Background(), 4); err != nil || s.Waiting() != 0 {
+		t.Fatalf("unexpected error: %v,waiting: %d", err, s.Waiting())
+	}
+
+	cancel()
+	if err := <-oversize; err != context.Canceled || s.Current() != 4 {
+		t.Fatalf("expected context.Canceled,got: %v", err)
+	}
+}
+
 func TestSemWithTimeout(t *testing.T) {
 	tickets, timeout := 1, 3*time.Second
 	s := New(tickets, timeout)
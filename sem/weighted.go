@@ -0,0 +1,165 @@
+package sem
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Weighted 带权重的信号量,每次可以获取或者释放n个ticket
+// 等待获取的请求按照先进先出的顺序满足,避免需要较多ticket的请求一直获取不到
+type Weighted struct {
+	mu      sync.Mutex
+	size    int64     // ticket总数
+	cur     int64     // 已经获取的ticket个数
+	waiters list.List // 等待获取ticket的请求,元素是*waiter
+}
+
+// waiter 等待获取n个ticket的请求,获取成功后关闭ready
+type waiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewWeighted 创建ticket总数为n的信号量
+func NewWeighted(n int64) *Weighted {
+	return &Weighted{size: n}
+}
+
+// Acquire 获取n个ticket,没有足够的ticket时阻塞等待,直到获取成功或者ctx被取消
+// ctx被取消后返回ctx.Err(),不会获取任何ticket,n小于等于0返回ErrInvalidWeight
+// n大于ticket总数时不会排队,避免阻塞后面的请求,只等待ctx被取消
+func (s *Weighted) Acquire(ctx context.Context, n int64) error {
+	if n <= 0 {
+		return ErrInvalidWeight
+	}
+
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	if n > s.size {
+		s.mu.Unlock()
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	w := &waiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// ctx被取消的同时获取成功了,归还获取的ticket
+			s.cur -= n
+		default:
+			s.waiters.Remove(elem)
+		}
+
+		// 队列头部的请求取消后,后面的请求可能可以获取成功
+		s.notify()
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire 尝试获取n个ticket,不会阻塞,获取成功返回true
+// 有其他请求正在等待或者n小于等于0时也返回false
+func (s *Weighted) TryAcquire(n int64) bool {
+	if n <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+
+	return false
+}
+
+// Release 释放n个ticket,释放的ticket超过已经获取的ticket返回ErrIllegalRelease
+// n小于等于0返回ErrInvalidWeight
+func (s *Weighted) Release(n int64) error {
+	if n <= 0 {
+		return ErrInvalidWeight
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cur < n {
+		return ErrIllegalRelease
+	}
+
+	s.cur -= n
+	s.notify()
+
+	return nil
+}
+
+// Resize 修改ticket总数,减少后已经获取的ticket不受影响
+// 已经获取的ticket释放到小于新的总数之后,等待的请求才能获取成功
+// 减少后正在等待的请求需要的ticket超过新的总数时,它和后面的请求会一直等待,直到再次Resize或者ctx被取消
+func (s *Weighted) Resize(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.size = n
+	s.notify()
+}
+
+// Size 返回ticket总数
+func (s *Weighted) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Current 返回已经获取的ticket个数
+func (s *Weighted) Current() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cur
+}
+
+// Waiting 返回正在等待获取ticket的请求个数
+func (s *Weighted) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.waiters.Len()
+}
+
+// notify 按照先进先出的顺序满足等待的请求,调用之前需要持有s.mu
+// 队列头部的请求获取不到足够的ticket时,后面的请求也不会获取,避免它一直等待
+func (s *Weighted) notify() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			return
+		}
+
+		w := next.Value.(*waiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+
+		s.cur += w.n
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
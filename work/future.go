@@ -0,0 +1,58 @@
+package work
+
+import (
+	"context"
+
+	"github.com/daheige/thinkgo/grecover"
+)
+
+// Future 等待SubmitFunc提交的任务的结果
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// SubmitFunc 提交返回T类型结果的任务,返回等待结果的Future
+// 提交失败的情况和Submit一样,fn panic时Future返回*PanicError
+func SubmitFunc[T any](ctx context.Context, p *Pool, fn func(ctx context.Context) (T, error)) (*Future[T], error) {
+	f := &Future[T]{
+		done: make(chan struct{}),
+	}
+
+	err := p.Submit(ctx, WorkerFunc(func(ctx context.Context) (err error) {
+		defer func() {
+			if e := recover(); e != nil {
+				err = &PanicError{Value: e, Stack: grecover.CatchStack()}
+			}
+
+			f.err = err
+			close(f.done)
+		}()
+
+		f.value, err = fn(ctx)
+		return err
+	}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Done 任务执行完毕后关闭的chan
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait 等待任务执行完毕,返回任务的结果和错误,ctx被取消后返回ctx.Err()
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
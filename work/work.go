@@ -8,24 +8,77 @@
 2. 这种使用无缓冲的通道的方法允许使用者知道什么时候 goroutine 池正在执行工作,
 而且如果池里的所有goroutine 都忙,无法接受新的工作的时候,也能及时通过通道来通知调用者。
 使用无缓冲的通道不会有工作在队列里丢失或者卡住,所有工作都会被处理。
+
+3. 通过Submit提交接收ctx并返回错误的worker,ctx取消后不再等待提交;
+通过SubmitFunc提交返回结果的任务,ShutdownContext在ctx结束之前等待已经提交的任务执行完毕。
 */
 package work
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"sync"
+
+	"github.com/daheige/thinkgo/grecover"
 )
 
+// ErrPoolClosed 工作池已经关闭,不能再提交任务
+var ErrPoolClosed = errors.New("work pool is closed")
+
 // Worker worker必须满足Task方法
 type Worker interface {
 	Task()
 }
 
+// ContextWorker 接收ctx并返回错误的worker
+type ContextWorker interface {
+	Run(ctx context.Context) error
+}
+
+// WorkerFunc 将func转换为ContextWorker
+type WorkerFunc func(ctx context.Context) error
+
+// Run 实现ContextWorker接口
+func (f WorkerFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// PanicError worker panic时的错误,Stack是grecover.CatchStack捕获的调用栈
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error 实现error接口
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("worker panic: %v", e.Value)
+}
+
 // Pool提供一个goroutine池,可以完成任何已提交的worker任务
 type Pool struct {
-	work chan Worker
-	wg   sync.WaitGroup
+	work   chan *job
+	wg     sync.WaitGroup
+	mu     sync.RWMutex       // 保证提交任务和关闭通道并发安全
+	closed bool               // 是否已经关闭
+	quit   chan struct{}      // 开始关闭时关闭,不再等待提交任务
+	once   sync.Once          // 保证只关闭一次
+	ctx    context.Context    // 关闭超时后取消,正在执行的worker的ctx会被取消
+	cancel context.CancelFunc // 取消p.ctx
+	done   chan struct{}      // 所有的goroutine执行完毕后关闭
+	logger Logger             // 日志输出实例
+	size   int                // 任务通道的缓冲大小
+
+	jobMu   sync.Mutex           // 保护cancels
+	cancels []context.CancelFunc // 每个goroutine正在执行的worker的ctx的cancel,ShutdownContext超时后调用
+}
+
+// job 提交到工作池的任务
+type job struct {
+	ctx context.Context
+	w   ContextWorker
 }
 
 // Logger log interface
@@ -35,49 +88,178 @@ type Logger interface {
 
 var LogEntry Logger = log.New(os.Stderr, "", log.LstdFlags)
 
+// Option 采用func Option功能模式为Pool添加参数
+type Option func(p *Pool)
+
+// WithLogger 设置打印worker错误的日志句柄,默认LogEntry
+func WithLogger(l Logger) Option {
+	return func(p *Pool) {
+		p.logger = l
+	}
+}
+
+// WithQueueSize 设置任务通道的缓冲大小,默认0,也就是无缓冲通道
+// 设置缓冲后,所有的goroutine都在执行任务时,提交任务不会立即阻塞
+func WithQueueSize(n int) Option {
+	return func(p *Pool) {
+		p.size = n
+	}
+}
+
 // New 创建一个工作池
-func New(gNum int) *Pool {
+func New(gNum int, opts ...Option) *Pool {
 	p := &Pool{
-		work: make(chan Worker), // 无缓冲通道
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	for _, o := range opts {
+		o(p)
+	}
+
+	if p.logger == nil {
+		p.logger = LogEntry
+	}
+
+	if p.size < 0 {
+		p.size = 0
 	}
 
+	p.work = make(chan *job, p.size) // 默认无缓冲通道
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.cancels = make([]context.CancelFunc, gNum)
+
 	p.wg.Add(gNum) // 最大goroutine个数
 	for i := 0; i < gNum; i++ {
 		// 开启独立的goroutine来执行任务
-		go func(p *Pool) {
-			defer catchRecover()
-
+		go func(p *Pool, i int) {
 			defer p.wg.Done() // 执行完毕后计数信号量减去1
 
-			// for...range会一直阻塞,直到从work通道中收到一个Worker接口值
-			for w := range p.work {
-				w.Task() // 执行任务
+			// for...range会一直阻塞,直到从work通道中收到一个任务
+			for j := range p.work {
+				if err := p.exec(i, j); err != nil {
+					p.logger.Println("exec worker error: ", err)
+				}
 			}
-		}(p)
+		}(p, i)
 	}
 
+	go func() {
+		p.wg.Wait()
+		close(p.done)
+	}()
+
 	return p
 }
 
 // Add 生产者:采用无缓冲通道提交任务到工作池
 // 当任务提交后，消费者就会立即执行任务，p.wg计数器数量减去1
 // w是一个接口值,必须是具体实现类型的一个实例指针
-func (p *Pool) Add(w Worker) {
-	p.work <- w
+// 工作池关闭后返回ErrPoolClosed
+func (p *Pool) Add(w Worker) error {
+	return p.Submit(context.Background(), WorkerFunc(func(ctx context.Context) error {
+		w.Task()
+		return nil
+	}))
+}
+
+// Submit 提交接收ctx的worker,等待有goroutine接收任务后返回
+// ctx被取消后不再等待,返回ctx.Err(),工作池关闭后返回ErrPoolClosed
+// worker执行时的ctx是提交时的ctx,ShutdownContext超时后也会被取消
+// worker返回的错误和panic会通过Logger打印
+func (p *Pool) Submit(ctx context.Context, w ContextWorker) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case p.work <- &job{ctx: ctx, w: w}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.quit:
+		return ErrPoolClosed
+	}
+}
+
+// exec 第i个goroutine执行worker,捕获worker的panic
+func (p *Pool) exec(i int, j *job) (err error) {
+	ctx := p.ctx
+	if j.ctx != context.Background() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(j.ctx)
+		defer cancel()
+
+		p.setCancel(i, cancel)
+		defer p.setCancel(i, nil)
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			err = &PanicError{Value: e, Stack: grecover.CatchStack()}
+		}
+	}()
+
+	return j.w.Run(ctx)
+}
+
+// setCancel 保存第i个goroutine正在执行的worker的ctx的cancel
+// p.ctx已经被取消时,直接取消worker的ctx
+func (p *Pool) setCancel(i int, cancel context.CancelFunc) {
+	p.jobMu.Lock()
+	defer p.jobMu.Unlock()
+
+	if cancel != nil && p.ctx.Err() != nil {
+		cancel()
+		return
+	}
+
+	p.cancels[i] = cancel
+}
+
+// cancelJobs 取消p.ctx和所有正在执行的worker的ctx
+func (p *Pool) cancelJobs() {
+	p.jobMu.Lock()
+	defer p.jobMu.Unlock()
+
+	p.cancel()
+	for _, cancel := range p.cancels {
+		if cancel != nil {
+			cancel()
+		}
+	}
 }
 
 // Shutdown 等待所有的goroutine执行完毕,它关闭了 work 通道
 // 这会导致所有池里的 goroutine 停止工作
 // 调用pg.wg 的 Wait 方法,会等待所有 goroutine 终止
 func (p *Pool) Shutdown() {
-	close(p.work) // 关闭通道会让所有池里的goroutine全部停止
-	p.wg.Wait()   // 等待所有的goroutine执行完毕
-	LogEntry.Println("all goroutine task finish")
+	p.ShutdownContext(context.Background())
 }
 
-// catchRecover 捕获异常或者panic处理
-func catchRecover() {
-	if err := recover(); err != nil {
-		LogEntry.Println("exec worker error: ", err)
+// ShutdownContext 关闭工作池,不再接收新的任务,等待已经提交的任务执行完毕
+// ctx结束时还没有执行完毕,取消正在执行的worker的ctx,返回ctx.Err()
+func (p *Pool) ShutdownContext(ctx context.Context) error {
+	p.once.Do(func() {
+		close(p.quit) // 不再等待提交任务
+
+		p.mu.Lock()
+		p.closed = true
+		close(p.work) // 关闭通道会让所有池里的goroutine执行完剩余的任务后停止
+		p.mu.Unlock()
+	})
+
+	select {
+	case <-p.done: // 等待所有的goroutine执行完毕
+		p.cancel()
+		p.logger.Println("all goroutine task finish")
+		return nil
+	case <-ctx.Done():
+		p.cancelJobs()
+		p.logger.Println("shutdown work pool error: ", ctx.Err())
+		return ctx.Err()
 	}
 }
@@ -1,10 +1,14 @@
 package work
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"runtime"
 	"sync"
 	"testing"
+	"time"
 )
 
 type myName struct {
@@ -78,3 +82,114 @@ func TestWorkPool(t *testing.T) {
 
 	p.Shutdown()
 }
+
+// errLogger 记录打印的错误
+type errLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *errLogger) Println(msg ...interface{}) {
+	l.mu.Lock()
+	l.msgs = append(l.msgs, fmt.Sprint(msg...))
+	l.mu.Unlock()
+}
+
+func TestSubmit(t *testing.T) {
+	logger := &errLogger{}
+	p := New(1, WithLogger(logger), WithQueueSize(10))
+
+	errWorker := errors.New("worker error")
+	for i := 0; i < 10; i++ {
+		i := i
+		err := p.Submit(context.Background(), WorkerFunc(func(ctx context.Context) error {
+			switch i {
+			case 3:
+				return errWorker
+			case 5:
+				panic("boom")
+			}
+
+			return nil
+		}))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the only goroutine survives the panic.
+	f, err := SubmitFunc(context.Background(), p, func(ctx context.Context) (int, error) {
+		return 42, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := f.Wait(context.Background()); v != 42 || err != nil {
+		t.Fatalf("unexpected result: %d,error: %v", v, err)
+	}
+
+	f, _ = SubmitFunc(context.Background(), p, func(ctx context.Context) (int, error) {
+		panic("boom")
+	})
+
+	var pe *PanicError
+	if _, err := f.Wait(context.Background()); !errors.As(err, &pe) {
+		t.Fatalf("expected panic error,got: %v", err)
+	}
+
+	p.Shutdown()
+	if err := p.Add(&myName{}); err != ErrPoolClosed {
+		t.Fatalf("expected ErrPoolClosed,got: %v", err)
+	}
+
+	// worker error,two panics and shutdown message.
+	if len(logger.msgs) != 4 {
+		t.Fatalf("unexpected logs: %v", logger.msgs)
+	}
+}
+
+func TestShutdownContext(t *testing.T) {
+	p := New(2, WithLogger(&errLogger{}))
+
+	cancelled := make(chan struct{}, 2)
+	p.Submit(context.Background(), WorkerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		cancelled <- struct{}{}
+		return ctx.Err()
+	}))
+
+	// the worker keeps the values of the submit ctx.
+	type key struct{}
+	p.Submit(context.WithValue(context.Background(), key{}, "v"), WorkerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		if ctx.Value(key{}) == "v" {
+			cancelled <- struct{}{}
+		}
+
+		return ctx.Err()
+	}))
+
+	// all goroutines are busy,submit waits until ctx timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Submit(ctx, WorkerFunc(func(ctx context.Context) error { return nil })); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded,got: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.ShutdownContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded,got: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("the running worker is not cancelled")
+		}
+	}
+}
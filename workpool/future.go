@@ -0,0 +1,80 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrPoolClosed is returned when a task is added after the pool stopped.
+	ErrPoolClosed = errors.New("workpool: pool is closed")
+
+	// ErrTaskDropped is returned when a queued task is dropped before exec.
+	ErrTaskDropped = errors.New("workpool: task dropped")
+)
+
+// PanicError is the error of a task which panic during exec.
+type PanicError struct {
+	Value interface{} // the value passed to panic
+	Stack []byte      // stack of the panic goroutine
+}
+
+// Error implements error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("workpool: task panic: %v", e.Value)
+}
+
+// Result task exec result.
+type Result struct {
+	Err       error     // error returned by task fn,or *PanicError when it panic
+	WorkerID  int       // id of the worker which run the task,0 means run in the caller goroutine or not run
+	Attempts  int       // exec times of the task fn
+	StartTime time.Time // task begin time
+	EndTime   time.Time // task end time
+}
+
+// Future is a handle of an added task,it can be used to wait for the task result.
+type Future struct {
+	done chan struct{}
+	res  Result
+}
+
+func newFuture() *Future {
+	return &Future{
+		done: make(chan struct{}),
+	}
+}
+
+// finish set the task result and wake up all waiters.
+func (f *Future) finish(res Result) {
+	f.res = res
+	close(f.done)
+}
+
+// Done returns a chan which is closed when the task finished.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the task finished or ctx is done.
+// It returns the task error,or ctx.Err() if ctx is done first.
+func (f *Future) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.res.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Result returns the task result,it returns zero Result if the task is not finished.
+func (f *Future) Result() Result {
+	select {
+	case <-f.done:
+		return f.res
+	default:
+		return Result{}
+	}
+}
@@ -0,0 +1,154 @@
+package workpool
+
+import (
+	"sync"
+	"time"
+)
+
+// keyLimiterSweep sweep the idle key limiters when the number of key limiters reaches it.
+var keyLimiterSweep = 1024
+
+// WithRateLimit limit the pool to exec rate tasks per second at most,
+// burst is the max number of tasks executed at once.
+// The tasks wait in the queue until they are allowed to run,
+// no limit is applied if rate <= 0.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(p *Pool) {
+		p.limiter = newLimiter(rate, burst)
+	}
+}
+
+// WithKeyRateLimit limit the tasks with the same key to exec rate tasks per second at most,
+// burst is the max number of tasks with the same key executed at once.
+// The tasks without key are not limited,no limit is applied if rate <= 0.
+func WithKeyRateLimit(rate float64, burst int) Option {
+	return func(p *Pool) {
+		if rate <= 0 {
+			p.keyLimiters = nil
+			return
+		}
+
+		p.keyLimiters = &keyLimiters{
+			rate:     rate,
+			burst:    burst,
+			limiters: make(map[string]*limiter),
+		}
+	}
+}
+
+// limiter token bucket rate limiter.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64 // bucket size
+	tokens float64 // available tokens,it's negative when the tokens are reserved
+	last   time.Time
+}
+
+// newLimiter returns a limiter with a full bucket,it returns nil if rate <= 0.
+func newLimiter(rate float64, burst int) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve take a token and returns the duration to wait before the token is available.
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.advance(now)
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// advance add the tokens generated since last time.
+func (l *limiter) advance(now time.Time) {
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+
+		l.last = now
+	}
+}
+
+// full returns true if the bucket is full.
+func (l *limiter) full(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.advance(now)
+	return l.tokens >= l.burst
+}
+
+// wait blocks until a token is available,it returns false if quit is closed first.
+// It returns true immediately if l is nil.
+func (l *limiter) wait(quit <-chan struct{}) bool {
+	if l == nil {
+		return true
+	}
+
+	d := l.reserve(time.Now())
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-quit:
+		return false
+	}
+}
+
+// keyLimiters rate limiters of each key.
+type keyLimiters struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    int
+	limiters map[string]*limiter
+}
+
+// get returns the limiter of key.
+func (k *keyLimiters) get(key string) *limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if l, ok := k.limiters[key]; ok {
+		return l
+	}
+
+	if len(k.limiters) >= keyLimiterSweep {
+		// the limiter with a full bucket is the same as a new one.
+		now := time.Now()
+		for key, l := range k.limiters {
+			if l.full(now) {
+				delete(k.limiters, key)
+			}
+		}
+	}
+
+	l := newLimiter(k.rate, k.burst)
+	k.limiters[key] = l
+	return l
+}
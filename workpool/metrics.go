@@ -0,0 +1,92 @@
+package workpool
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithMetrics register the pool stats as prometheus collector to
+// prometheus.DefaultRegisterer,name is used as the pool label of metrics.
+// It works with the metrics of monitor package which are registered to
+// the default registerer too,so they can be exposed by promhttp.Handler().
+func WithMetrics(name string) Option {
+	return func(p *Pool) {
+		p.metricsName = name
+	}
+}
+
+// registerMetrics register the pool collector if metrics name is specified.
+func (p *Pool) registerMetrics() {
+	if p.metricsName == "" {
+		return
+	}
+
+	if err := prometheus.Register(NewCollector(p, p.metricsName)); err != nil {
+		p.logEntry.Println("register workpool metrics error: ", err)
+	}
+}
+
+// collector prometheus collector of pool stats.
+type collector struct {
+	pool        *Pool
+	entryQueued *prometheus.Desc
+	jobQueued   *prometheus.Desc
+	workers     *prometheus.Desc
+	busyWorkers *prometheus.Desc
+	completed   *prometheus.Desc
+	failed      *prometheus.Desc
+	panicked    *prometheus.Desc
+	dropped     *prometheus.Desc
+	runTime     *prometheus.Desc
+}
+
+// NewCollector returns a prometheus collector of the pool stats,
+// name is used as the pool label of metrics.
+// It can be registered to a custom registerer.
+func NewCollector(p *Pool, name string) prometheus.Collector {
+	labels := prometheus.Labels{"pool": name}
+	newDesc := func(metric, help string, variableLabels ...string) *prometheus.Desc {
+		return prometheus.NewDesc("workpool_"+metric, help, variableLabels, labels)
+	}
+
+	return &collector{
+		pool:        p,
+		entryQueued: newDesc("entry_queued", "Number of tasks in entry chan"),
+		jobQueued:   newDesc("job_queued", "Number of tasks in job chan"),
+		workers:     newDesc("workers", "Number of running workers"),
+		busyWorkers: newDesc("busy_workers", "Number of workers running task"),
+		completed:   newDesc("tasks_completed_total", "Number of finished tasks"),
+		failed:      newDesc("tasks_failed_total", "Number of tasks returned error"),
+		panicked:    newDesc("tasks_panicked_total", "Number of tasks panic"),
+		dropped:     newDesc("tasks_dropped_total", "Number of dropped tasks"),
+		runTime:     newDesc("task_run_seconds", "Run time of tasks in seconds", "stat"),
+	}
+}
+
+// Describe implements prometheus.Collector interface.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entryQueued
+	ch <- c.jobQueued
+	ch <- c.workers
+	ch <- c.busyWorkers
+	ch <- c.completed
+	ch <- c.failed
+	ch <- c.panicked
+	ch <- c.dropped
+	ch <- c.runTime
+}
+
+// Collect implements prometheus.Collector interface.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.pool.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.entryQueued, prometheus.GaugeValue, float64(stats.EntryQueued))
+	ch <- prometheus.MustNewConstMetric(c.jobQueued, prometheus.GaugeValue, float64(stats.JobQueued))
+	ch <- prometheus.MustNewConstMetric(c.workers, prometheus.GaugeValue, float64(stats.Workers))
+	ch <- prometheus.MustNewConstMetric(c.busyWorkers, prometheus.GaugeValue, float64(stats.BusyWorkers))
+	ch <- prometheus.MustNewConstMetric(c.completed, prometheus.CounterValue, float64(stats.Completed))
+	ch <- prometheus.MustNewConstMetric(c.failed, prometheus.CounterValue, float64(stats.Failed))
+	ch <- prometheus.MustNewConstMetric(c.panicked, prometheus.CounterValue, float64(stats.Panicked))
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(stats.Dropped))
+	ch <- prometheus.MustNewConstMetric(c.runTime, prometheus.GaugeValue, stats.AvgRunTime.Seconds(), "avg")
+	ch <- prometheus.MustNewConstMetric(c.runTime, prometheus.GaugeValue, stats.P99RunTime.Seconds(), "p99")
+}
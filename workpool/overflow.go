@@ -0,0 +1,142 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+)
+
+// OverflowPolicy policy to handle the task when the entry chan is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock block until the task is sent to the entry chan.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowReject reject the task with ErrPoolFull.
+	OverflowReject
+
+	// OverflowDropOldest drop the oldest task in the entry chan of the same priority,
+	// the dropped task is finished with ErrTaskDropped.
+	// It blocks like OverflowBlock when the entry chan has no buffer.
+	OverflowDropOldest
+
+	// OverflowCallerRuns run the task in the caller goroutine,
+	// the task key does not take effect in this case.
+	OverflowCallerRuns
+)
+
+var (
+	// ErrPoolFull is returned when the entry chan is full.
+	ErrPoolFull = errors.New("workpool: pool is full")
+
+	// ErrNilTask is returned when the task is nil.
+	ErrNilTask = errors.New("workpool: task is nil")
+
+	// errCallerRuns the task should run in the caller goroutine.
+	errCallerRuns = errors.New("workpool: caller runs")
+)
+
+// WithOverflowPolicy change the policy when the entry chan is full,default OverflowBlock.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(p *Pool) {
+		p.overflowPolicy = policy
+	}
+}
+
+// TryAddTask add a task to the entry chan without blocking.
+// It returns ErrPoolFull if the entry chan is full,
+// or ErrPoolClosed if the pool is stopped.
+func (p *Pool) TryAddTask(t *Task) (*Future, error) {
+	if t == nil {
+		return nil, ErrNilTask
+	}
+
+	j := newJob(t)
+	if err := p.submit(context.Background(), j, OverflowReject); err != nil {
+		return nil, err
+	}
+
+	return j.future, nil
+}
+
+// AddTaskContext add a task to the entry chan,the task is handled by
+// the overflow policy when the entry chan is full.
+// If the policy is OverflowBlock,it blocks until the task is sent or ctx is done.
+func (p *Pool) AddTaskContext(ctx context.Context, t *Task) (*Future, error) {
+	if t == nil {
+		return nil, ErrNilTask
+	}
+
+	j := newJob(t)
+	if err := p.submit(ctx, j, p.overflowPolicy); err != nil {
+		return nil, err
+	}
+
+	return j.future, nil
+}
+
+// submit send a job to the entry chan,the job is handled by policy when the entry chan is full.
+func (p *Pool) submit(ctx context.Context, j *job, policy OverflowPolicy) error {
+	err := p.send(ctx, j, policy)
+	if err == errCallerRuns {
+		p.finishJob(j, j.task.run(p.ctx, 0, p.logEntry))
+		return nil
+	}
+
+	return err
+}
+
+// send send a job to the entry chan of the job priority.
+func (p *Pool) send(ctx context.Context, j *job, policy OverflowPolicy) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	select {
+	case <-p.stop:
+		return ErrPoolClosed
+	default:
+	}
+
+	lane := p.lanes[j.task.priority]
+	select {
+	case lane <- j:
+		return nil
+	default:
+	}
+
+	switch policy {
+	case OverflowReject:
+		return ErrPoolFull
+	case OverflowCallerRuns:
+		return errCallerRuns
+	case OverflowDropOldest:
+		if cap(lane) == 0 {
+			break
+		}
+
+		for {
+			select {
+			case old := <-lane:
+				p.drop(old)
+			default:
+			}
+
+			select {
+			case <-p.stop:
+				return ErrPoolClosed
+			case lane <- j:
+				return nil
+			default:
+			}
+		}
+	}
+
+	select {
+	case <-p.stop:
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case lane <- j:
+		return nil
+	}
+}
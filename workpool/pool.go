@@ -5,37 +5,24 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
-// Task task struct.
-type Task struct {
-	fn func() error
+// job a task sent to the pool with its future.
+type job struct {
+	task     *Task
+	future   *Future
+	enqueued time.Time // time of the task added
 }
 
-// NewTask returns task,create a task entry.
-func NewTask(fn func() error) *Task {
-	return &Task{
-		fn: fn,
-	}
-}
-
-// run exec a task.
-func (t *Task) run(logEntry Logger) {
-	if t == nil {
-		return
-	}
-
-	defer func() {
-		if e := recover(); e != nil {
-			logEntry.Println("exec current task panic: ", e)
-		}
-	}()
-
-	err := t.fn()
-	if err != nil {
-		logEntry.Println("exec task error: ", err)
+func newJob(t *Task) *job {
+	return &job{
+		task:     t,
+		future:   newFuture(),
+		enqueued: time.Now(),
 	}
 }
 
@@ -47,18 +34,64 @@ type Logger interface {
 // Pool task work pool
 type Pool struct {
 	// execInterval interval time after each task is executed
-	// interval default 10ms
+	// interval default 0
 	execInterval   time.Duration
-	entryChan      chan *Task     // task entry chan
-	entryCap       int            // entry chan num
-	jobChan        chan *Task     // job chan
-	jobCap         int            // job chan num
-	workerCap      int            // worker chan num
-	logEntry       Logger         // logger interface
-	stop           chan struct{}  // stop sem
-	interrupt      chan os.Signal // interrupt signal
-	entryCloseWait time.Duration  // close entry chan wait time,default 5s
-	shutdownWait   time.Duration  // work pool shutdown wait time,default 3s
+	lanes          [priorityNum]chan *job // task entry chan of each priority
+	entryCap       int                    // entry chan num of each priority
+	jobChan        chan *job              // job chan
+	jobCap         int                    // job chan num
+	workerCap      int                    // worker chan num
+	minWorker      int                    // min worker num,equal to maxWorker when autoscaling is disabled
+	maxWorker      int                    // max worker num
+	idleTimeout    time.Duration          // idle worker exits after it when worker num > minWorker
+	scaleBacklog   int                    // start a new worker when the job chan backlog reaches it
+	scaleLatency   time.Duration          // start a new worker when a task waits in queue longer than it
+	logEntry       Logger                 // logger interface
+	stop           chan struct{}          // stop sem,closed when shutdown begin
+	quit           chan struct{}          // closed when drain deadline exceeded,queued tasks are dropped
+	done           chan struct{}          // closed when all workers exit
+	ctx            context.Context        // base context of tasks,canceled when the pool quit
+	cancel         context.CancelFunc     // cancel the base context of tasks
+	interrupt      chan os.Signal         // interrupt signal
+	signals        []os.Signal            // signals to listen,no signal is listened by RunContext default
+	entryCloseWait time.Duration          // close entry chan wait time,default 5s
+	shutdownWait   time.Duration          // work pool shutdown wait time,default 3s
+	overflowPolicy OverflowPolicy         // policy when the entry chan is full,default OverflowBlock
+	metricsName    string                 // pool label of prometheus metrics,metrics are not registered if empty
+	limiter        *limiter               // rate limiter of all tasks,nil means no limit
+	keyLimiters    *keyLimiters           // rate limiters of each task key,nil means no limit
+
+	mu            sync.RWMutex // protect sending to entry chan while pool exits
+	stopOnce      sync.Once
+	quitOnce      sync.Once
+	completed     int64         // number of finished tasks
+	failed        int64         // number of tasks returned error
+	panicked      int64         // number of tasks panic
+	busy          int64         // number of workers running task
+	runTime       int64         // total run time of finished tasks in nanoseconds
+	runTimes      *durationRing // run time of the latest finished tasks
+	stopCompleted int64         // number of finished tasks when shutdown begin
+	dropped       int64         // number of dropped tasks
+	stopDropped   int64         // number of dropped tasks when shutdown begin
+
+	workerMu     sync.Mutex     // protect the fields of workers
+	workerWg     sync.WaitGroup // wait for all workers to exit
+	workers      int            // number of running workers
+	lastWorkerID int            // id of the latest started worker
+	running      bool           // whether the pool is running
+	exited       bool           // whether the job chan is closed
+	retireCh     chan struct{}  // notify workers to exit when the pool is resized
+
+	starvationLimit int               // a lower priority lane is polled first every starvationLimit polls
+	polled          int               // poll times of lanes,only used by dispatcher
+	keyMu           sync.Mutex        // protect keys
+	keys            map[string][]*job // pending jobs of the running keys
+}
+
+// ShutdownResult shutdown result of the pool.
+type ShutdownResult struct {
+	Completed int64 // number of tasks finished after shutdown begin
+	Dropped   int64 // number of queued tasks dropped after shutdown begin
 }
 
 var (
@@ -75,11 +108,11 @@ var (
 	// defaultMinWorker default min worker.
 	defaultMinWorker = 3
 
-	// empty struct
-	est = struct{}{}
-
 	// dummy logger writes nothing.
 	dummyLogger = LoggerFunc(func(...interface{}) {})
+
+	// defaultSignals signals listened by Run.
+	defaultSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP}
 )
 
 // LoggerFunc is a bridge between Logger and any third party logger.
@@ -91,7 +124,9 @@ func (f LoggerFunc) Println(args ...interface{}) { f(args...) }
 // Option func Option to change pool.
 type Option func(p *Pool)
 
-// WithExecInterval interval time after each task is executed.
+// WithExecInterval interval time after each task is executed,default 0.
+//
+// Deprecated: the worker sleeps after each task,use WithRateLimit to limit the exec rate.
 func WithExecInterval(t time.Duration) Option {
 	return func(p *Pool) {
 		p.execInterval = t
@@ -127,60 +162,78 @@ func WithLogger(logEntry Logger) Option {
 }
 
 // WithEntryCloseWait close entry chan entryCloseWait time.
+//
+// Deprecated: the pool stops accepting tasks as soon as shutdown begin
+// and it no longer waits for a fixed time,use WithShutdownWait to limit the drain time.
 func WithEntryCloseWait(d time.Duration) Option {
 	return func(p *Pool) {
 		p.entryCloseWait = d
 	}
 }
 
-// WithShutdownWait change shutdown entryCloseWait time.
+// WithShutdownWait change the max time to drain queued tasks
+// when the pool exits by ctx done or signal,the rest tasks are dropped after it.
 func WithShutdownWait(d time.Duration) Option {
 	return func(p *Pool) {
 		p.shutdownWait = d
 	}
 }
 
+// WithSignals listen the signals to shutdown the pool.
+// RunContext listens no signal default,and Run listens
+// SIGINT,SIGTERM,SIGHUP if no signal is specified.
+func WithSignals(sig ...os.Signal) Option {
+	return func(p *Pool) {
+		p.signals = sig
+	}
+}
+
 // NewPool returns a pool.
 func NewPool(opts ...Option) *Pool {
 	p := &Pool{
-		execInterval:   10 * time.Millisecond,
-		workerCap:      defaultMinWorker,
-		stop:           make(chan struct{}, 1),
-		entryCloseWait: 5 * time.Second,
-		shutdownWait:   3 * time.Second,
-		interrupt:      make(chan os.Signal, 1),
-		logEntry:       dummyLogger, // default logger entry.
+		workerCap:       defaultMinWorker,
+		stop:            make(chan struct{}),
+		quit:            make(chan struct{}),
+		done:            make(chan struct{}),
+		entryCloseWait:  5 * time.Second,
+		shutdownWait:    3 * time.Second,
+		interrupt:       make(chan os.Signal, 1),
+		retireCh:        make(chan struct{}, defaultMaxWorker),
+		keys:            make(map[string][]*job),
+		runTimes:        newDurationRing(runTimeSamples),
+		starvationLimit: defaultStarvationLimit,
+		logEntry:        dummyLogger, // default logger entry.
 	}
 
 	// option functions.
 	p.apply(opts...)
 
-	if p.workerCap >= defaultMaxWorker {
-		p.workerCap = defaultMaxWorker
-	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	p.initWorkerNum()
 
 	if p.jobCap == 0 {
 		// no buf for jobChan.
-		p.jobChan = make(chan *Task)
+		p.jobChan = make(chan *job)
 	} else {
 		if p.jobCap >= defaultMaxJobCap {
 			p.jobCap = defaultMaxJobCap
 		}
 
-		p.jobChan = make(chan *Task, p.jobCap)
+		p.jobChan = make(chan *job, p.jobCap)
 	}
 
-	if p.entryCap == 0 {
-		// no buf for entryChan.
-		p.entryChan = make(chan *Task)
-	} else {
-		if p.entryCap >= defaultMaxEntryCap {
-			p.entryCap = defaultMaxEntryCap
-		}
+	if p.entryCap >= defaultMaxEntryCap {
+		p.entryCap = defaultMaxEntryCap
+	}
 
-		p.entryChan = make(chan *Task, p.entryCap)
+	// no buf for entry chan if entryCap is 0.
+	for k := range p.lanes {
+		p.lanes[k] = make(chan *job, p.entryCap)
 	}
 
+	p.registerMetrics()
+
 	return p
 }
 
@@ -190,119 +243,326 @@ func (p *Pool) apply(opts ...Option) {
 	}
 }
 
-// AddTask add a task to p.entryChan.
-func (p *Pool) AddTask(t *Task) {
+// AddTask add a task to the entry chan of the task priority.
+// When the entry chan is full,the task is handled by the overflow policy,
+// it blocks until the task is sent by default.
+// The returned future can be used to wait for the task result,
+// it's ok to ignore it when the result is not needed.
+// If the task is not accepted,the future is finished with ErrPoolClosed or ErrPoolFull.
+// If t is nil, AddTask returns nil.
+func (p *Pool) AddTask(t *Task) *Future {
 	if t == nil {
-		return
+		return nil
 	}
 
-	defer p.recovery()
+	j := newJob(t)
+	if err := p.submit(context.Background(), j, p.overflowPolicy); err != nil {
+		j.future.finish(Result{Err: err})
+	}
 
-	select {
-	case <-p.stop:
-		return
-	default:
-		p.entryChan <- t
+	return j.future
+}
+
+// BatchAddTask batch add task to the entry chan.
+// The futures are returned in the same order as t,
+// the future of a nil task is nil.
+func (p *Pool) BatchAddTask(t []*Task) []*Future {
+	futures := make([]*Future, len(t))
+	for k := range t {
+		futures[k] = p.AddTask(t[k])
 	}
+
+	return futures
 }
 
-// BatchAddTask batch add task to p.entryChan.
-func (p *Pool) BatchAddTask(t []*Task) {
-	defer p.recovery()
+// drop drop a queued job.
+func (p *Pool) drop(j *job) {
+	atomic.AddInt64(&p.dropped, 1)
+	j.future.finish(Result{Err: ErrTaskDropped})
+}
 
-	for k := range t {
-		if t[k] == nil {
-			continue
-		}
+// dropJobs drop a job and the pending jobs with the same key.
+func (p *Pool) dropJobs(j *job) {
+	for ; j != nil; j = p.unlockKey(j) {
+		p.drop(j)
+	}
+}
 
+// dropQueued drop all jobs left in the chan without blocking.
+func (p *Pool) dropQueued(ch chan *job, drop func(j *job)) {
+	for {
 		select {
-		case <-p.stop:
-			return
+		case j, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			drop(j)
 		default:
-			p.entryChan <- t[k]
+			return
 		}
 	}
 }
 
 // exec exec task from job chan.
-func (p *Pool) exec(id int, done chan struct{}) {
+func (p *Pool) exec(id int) {
 	defer p.recovery()
 
 	defer func() {
-		done <- est
+		p.workerWg.Done()
 		p.logEntry.Println("current worker id: ", id, "will exit...")
 	}()
 
+	var idle *time.Timer
+	var idleC <-chan time.Time
+	if p.idleTimeout > 0 {
+		idle = time.NewTimer(p.idleTimeout)
+		defer idle.Stop()
+
+		idleC = idle.C
+	}
+
 	// get task from JobChan to run.
-	for task := range p.jobChan {
-		task.run(p.logEntry)
-		p.logEntry.Println("current worker id: ", id)
+	for {
+		select {
+		case j, ok := <-p.jobChan:
+			if !ok {
+				p.retire(false, true)
+				return
+			}
+
+			p.runJobs(id, j)
+
+			if idle != nil {
+				if !idle.Stop() {
+					select {
+					case <-idle.C:
+					default:
+					}
+				}
+
+				idle.Reset(p.idleTimeout)
+			}
+		case <-idleC:
+			if p.retire(true, false) {
+				return
+			}
+
+			idle.Reset(p.idleTimeout)
+		case <-p.retireCh:
+			if p.retire(false, false) {
+				return
+			}
+		}
+	}
+}
+
+// runJobs run a job and the pending jobs with the same key in the worker.
+func (p *Pool) runJobs(id int, j *job) {
+	p.runJob(id, j)
+	for j = p.unlockKey(j); j != nil; j = p.unlockKey(j) {
+		// the pending jobs are not limited by dispatcher.
+		p.limiter.wait(p.quit)
+		p.runJob(id, j)
+	}
+}
+
+// runJob run a job in the worker.
+func (p *Pool) runJob(id int, j *job) {
+	if p.keyLimiters != nil && j.task.key != "" {
+		p.keyLimiters.get(j.task.key).wait(p.quit)
+	}
+
+	select {
+	case <-p.quit:
+		p.drop(j)
+		return
+	default:
+	}
+
+	if p.scaleLatency > 0 && time.Since(j.enqueued) >= p.scaleLatency {
+		p.scaleUp()
+	}
+
+	atomic.AddInt64(&p.busy, 1)
+	p.finishJob(j, j.task.run(p.ctx, id, p.logEntry))
+	atomic.AddInt64(&p.busy, -1)
+	p.logEntry.Println("current worker id: ", id)
+
+	// interval time after each task is executed.
+	if p.execInterval > 0 {
+		time.Sleep(p.execInterval)
+	}
+}
+
+// dispatch throw entry chan task to job chan until the pool stopped.
+func (p *Pool) dispatch() {
+	defer func() {
+		p.workerMu.Lock()
+		p.exited = true
+		p.workerMu.Unlock()
+
+		close(p.jobChan)
+	}()
+
+	for {
+		j, ok := p.nextJob()
+		if !ok {
+			break
+		}
+
+		if !p.dispatchJob(j) {
+			return
+		}
+	}
 
-		// interval time after each task is executed.
-		if p.execInterval > 0 {
-			time.Sleep(p.execInterval)
+	// throw the tasks which have been sent to entry chan before stop.
+	for j := p.pollJob(); j != nil; j = p.pollJob() {
+		if !p.dispatchJob(j) {
+			return
 		}
 	}
 }
 
-// Run create workerCap goroutine to exec task.
-func (p *Pool) Run() {
-	p.logEntry.Println("exec task begin...")
-	signal.Notify(p.interrupt, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+// dispatchJob send a job to job chan unless a task with the same key is running,
+// it waits for the rate limiter before sending and returns false when the pool quit.
+func (p *Pool) dispatchJob(j *job) bool {
+	if !p.lockKey(j) {
+		return true
+	}
 
-	doneBuf := make(chan struct{}, p.workerCap)
-	// create p.workerCap goroutine to do task
-	for i := 0; i < p.workerCap; i++ {
-		go p.exec(i+1, doneBuf)
+	if !p.limiter.wait(p.quit) {
+		p.dropJobs(j)
+		return false
 	}
 
-	// throw entry chan task to JobChan
-	go func() {
-		defer close(p.jobChan)
+	return p.toJob(j)
+}
 
-		// If the entry channel is closed, the block will be lifted until consumption is completed.
-		for task := range p.entryChan {
-			p.jobChan <- task
+// toJob send a job to job chan,it returns false when the pool quit.
+func (p *Pool) toJob(j *job) bool {
+	select {
+	case p.jobChan <- j:
+		if p.scaleBacklog > 0 && len(p.jobChan) >= p.scaleBacklog {
+			p.scaleUp()
 		}
-	}()
 
-	// listen interrupt signal for work pool graceful exit.
-	go func() {
-		// Block until we receive stop signal.
-		sig := <-p.interrupt
-		p.logEntry.Println("recv signal: ", sig.String())
-		close(p.stop)
+		return true
+	default:
+	}
+
+	// all workers are busy,try to start a new worker.
+	p.scaleUp()
+
+	select {
+	case p.jobChan <- j:
+		return true
+	case <-p.quit:
+		p.dropJobs(j)
+		return false
+	}
+}
+
+// Run create workerCap goroutine to exec task.
+// It listens SIGINT,SIGTERM,SIGHUP to shutdown the pool
+// if no signal is specified by WithSignals.
+func (p *Pool) Run() {
+	if len(p.signals) == 0 {
+		p.signals = defaultSignals
+	}
+
+	p.RunContext(context.Background())
+}
+
+// RunContext create minWorker goroutine to exec task,it blocks until the pool exits.
+// When ctx is done or the signal specified by WithSignals is received,
+// the pool stops accepting tasks and drains the queued tasks within shutdownWait.
+func (p *Pool) RunContext(ctx context.Context) {
+	p.logEntry.Println("exec task begin...")
+	if len(p.signals) > 0 {
+		signal.Notify(p.interrupt, p.signals...)
+		defer signal.Stop(p.interrupt)
+	}
 
-		// Here you need to entryCloseWait for the task that has been sent to the entry chan
-		// to ensure that it can be sent successfully
-		ctx, cancel := context.WithTimeout(context.Background(), p.entryCloseWait)
-		defer cancel()
+	// create p.minWorker goroutine to do task
+	p.workerMu.Lock()
+	p.running = true
+	p.spawn(p.minWorker - p.workers)
+	p.workerMu.Unlock()
 
-		<-ctx.Done()
+	go p.dispatch()
 
-		close(p.entryChan)
+	// listen ctx done and interrupt signal for work pool graceful exit.
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.logEntry.Println("context done: ", ctx.Err())
+		case sig := <-p.interrupt:
+			p.logEntry.Println("recv signal: ", sig.String())
+		case <-p.stop:
+			return
+		}
+
+		p.Shutdown()
 	}()
 
-	// entryCloseWait all job chan task to finish.
-	for i := 0; i < p.workerCap; i++ {
-		<-doneBuf
+	// wait all job chan task to finish.
+	p.workerWg.Wait()
+
+	// wait the sending tasks and drop the tasks sent after the entry chan drained.
+	p.mu.Lock()
+	for k := range p.lanes {
+		p.dropQueued(p.lanes[k], p.drop)
 	}
+	p.mu.Unlock()
 
+	close(p.done)
+	p.cancel()
 	p.logEntry.Println("work pool shutdown success")
 }
 
-// Shutdown If all task are sent to the task entry chan, you can call this method to exit smoothly.
+// Shutdown stops accepting tasks and waits at most shutdownWait for the queued tasks to finish.
+// It returns as soon as the pool exits,use ShutdownContext to get the shutdown result.
 func (p *Pool) Shutdown() {
-	// Create a deadline to manual exit entryCloseWait time.
-	ctx, cancel := context.WithTimeout(context.Background(), p.entryCloseWait)
+	ctx, cancel := context.WithTimeout(context.Background(), p.shutdownWait)
 	defer cancel()
 
-	// Doesn't block if no task, but will otherwise entryCloseWait
-	// until the timeout deadline.
-	<-ctx.Done()
+	p.ShutdownContext(ctx)
+}
+
+// ShutdownContext stops accepting tasks and waits for the queued tasks to finish.
+// It returns as soon as the pool exits,if ctx is done first,
+// the queued tasks are dropped and ctx.Err() is returned,
+// the context of the running tasks is canceled but they are not waited.
+func (p *Pool) ShutdownContext(ctx context.Context) (ShutdownResult, error) {
+	p.stopOnce.Do(func() {
+		p.logEntry.Println("work pool will shutdown...")
+		atomic.StoreInt64(&p.stopCompleted, atomic.LoadInt64(&p.completed))
+		atomic.StoreInt64(&p.stopDropped, atomic.LoadInt64(&p.dropped))
+		close(p.stop)
+	})
+
+	var err error
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		p.quitOnce.Do(func() {
+			p.cancel()
+			close(p.quit)
+		})
+
+		for k := range p.lanes {
+			p.dropQueued(p.lanes[k], p.drop)
+		}
+
+		p.dropQueued(p.jobChan, p.dropJobs)
+	}
 
-	p.interrupt <- syscall.SIGTERM
-	p.logEntry.Println("work pool will shutdown...")
+	return ShutdownResult{
+		Completed: atomic.LoadInt64(&p.completed) - atomic.LoadInt64(&p.stopCompleted),
+		Dropped:   atomic.LoadInt64(&p.dropped) - atomic.LoadInt64(&p.stopDropped),
+	}, err
 }
 
 // recovery catch a recover.
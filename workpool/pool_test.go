@@ -1,10 +1,17 @@
 package workpool
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestPool(t *testing.T) {
@@ -68,6 +75,518 @@ func TestShutdown(t *testing.T) {
 	p.Run()
 }
 
+func TestFuture(t *testing.T) {
+	p := NewPool(
+		WithExecInterval(0),
+		WithEntryCap(10), WithJobCap(10), WithWorkerCap(3),
+	)
+
+	go p.Run()
+	defer p.ShutdownContext(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	errTask := errors.New("task error")
+	futures := p.BatchAddTask([]*Task{
+		NewTask(func() error {
+			return nil
+		}),
+		NewTask(func() error {
+			return errTask
+		}),
+		nil,
+		NewTask(func() error {
+			panic("task panic")
+		}),
+	})
+
+	if err := futures[0].Wait(ctx); err != nil {
+		t.Fatalf("expected nil error,got: %v", err)
+	}
+
+	res := futures[0].Result()
+	if res.WorkerID == 0 || res.StartTime.IsZero() || res.EndTime.Before(res.StartTime) {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if err := futures[1].Wait(ctx); err != errTask {
+		t.Fatalf("expected %v,got: %v", errTask, err)
+	}
+
+	if futures[2] != nil {
+		t.Fatal("expected nil future for nil task")
+	}
+
+	err := futures[3].Wait(ctx)
+	pe, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("expected *PanicError,got: %v", err)
+	}
+
+	if pe.Value != "task panic" || len(pe.Stack) == 0 {
+		t.Fatalf("unexpected panic error: %v", pe)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	p := NewPool(
+		WithExecInterval(0),
+		WithEntryCap(100), WithJobCap(10), WithWorkerCap(2),
+		WithShutdownWait(100*time.Millisecond),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{})
+	go func() {
+		defer close(exit)
+		p.RunContext(ctx)
+	}()
+
+	block := make(chan struct{})
+	started := make(chan struct{}, 50)
+	futures := make([]*Future, 0, 50)
+	for i := 0; i < 50; i++ {
+		futures = append(futures, p.AddTask(NewTask(func() error {
+			started <- struct{}{}
+			<-block
+			return nil
+		})))
+	}
+
+	// the queued tasks are dropped after shutdownWait.
+	<-started
+	<-started
+	cancel()
+	time.Sleep(200 * time.Millisecond)
+	close(block)
+
+	select {
+	case <-exit:
+	case <-time.After(3 * time.Second):
+		t.Fatal("pool did not exit")
+	}
+
+	var completed, dropped int
+	for _, f := range futures {
+		switch err := f.Wait(context.Background()); err {
+		case nil:
+			completed++
+		case ErrTaskDropped:
+			dropped++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if completed != 2 || dropped != 48 {
+		t.Fatalf("expected 2 completed and 48 dropped,got %d,%d", completed, dropped)
+	}
+
+	if err := p.AddTask(NewTask(func() error { return nil })).Wait(context.Background()); err != ErrPoolClosed {
+		t.Fatalf("expected %v,got: %v", ErrPoolClosed, err)
+	}
+}
+
+func TestShutdownContext(t *testing.T) {
+	p := NewPool(WithExecInterval(0), WithEntryCap(100), WithWorkerCap(5))
+	go p.RunContext(context.Background())
+
+	var cnt int64
+	for i := 0; i < 100; i++ {
+		p.AddTask(NewTask(func() error {
+			atomic.AddInt64(&cnt, 1)
+			return nil
+		}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := p.ShutdownContext(ctx)
+	if err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+
+	if res.Dropped != 0 || atomic.LoadInt64(&cnt) != 100 {
+		t.Fatalf("unexpected shutdown result: %+v,cnt: %d", res, cnt)
+	}
+}
+
+func TestAutoScale(t *testing.T) {
+	p := NewPool(
+		WithExecInterval(0),
+		WithEntryCap(100),
+		WithMinWorkers(1), WithMaxWorkers(4),
+		WithIdleTimeout(50*time.Millisecond),
+	)
+
+	go p.RunContext(context.Background())
+	defer p.ShutdownContext(context.Background())
+
+	block := make(chan struct{})
+	futures := make([]*Future, 0, 10)
+	for i := 0; i < 10; i++ {
+		futures = append(futures, p.AddTask(NewTask(func() error {
+			<-block
+			return nil
+		})))
+	}
+
+	waitWorkers(t, p, 4)
+	close(block)
+	for _, f := range futures {
+		if err := f.Wait(context.Background()); err != nil {
+			t.Fatalf("task error: %v", err)
+		}
+	}
+
+	// idle workers exit until min workers.
+	waitWorkers(t, p, 1)
+}
+
+func TestResize(t *testing.T) {
+	p := NewPool(WithExecInterval(0), WithWorkerCap(2))
+	go p.RunContext(context.Background())
+	defer p.ShutdownContext(context.Background())
+
+	waitWorkers(t, p, 2)
+	p.Resize(5)
+	waitWorkers(t, p, 5)
+	p.Resize(1)
+	waitWorkers(t, p, 1)
+
+	if err := p.AddTask(NewTask(func() error { return nil })).Wait(context.Background()); err != nil {
+		t.Fatalf("task error: %v", err)
+	}
+}
+
+func waitWorkers(t *testing.T, p *Pool, n int) {
+	deadline := time.Now().Add(3 * time.Second)
+	for p.Workers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d workers,got %d", n, p.Workers())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	p := NewPool(WithExecInterval(0), WithEntryCap(10), WithWorkerCap(1), WithStarvationLimit(0))
+	go p.RunContext(context.Background())
+	defer p.ShutdownContext(context.Background())
+
+	// block the only worker until all tasks are added.
+	block := make(chan struct{})
+	started := make(chan struct{})
+	p.AddTask(NewTask(func() error {
+		close(started)
+		<-block
+		return nil
+	}))
+	<-started
+
+	// the dispatcher holds a task while waiting for a free worker.
+	p.AddTask(NewTask(func() error { return nil }, WithPriority(PriorityHigh)))
+
+	var mu sync.Mutex
+	var order []Priority
+	futures := make([]*Future, 0, 6)
+	for _, priority := range []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityLow, PriorityHigh, PriorityNormal} {
+		priority := priority
+		futures = append(futures, p.AddTask(NewTask(func() error {
+			mu.Lock()
+			order = append(order, priority)
+			mu.Unlock()
+			return nil
+		}, WithPriority(priority))))
+	}
+
+	close(block)
+	for _, f := range futures {
+		f.Wait(context.Background())
+	}
+
+	expected := []Priority{PriorityHigh, PriorityHigh, PriorityNormal, PriorityNormal, PriorityLow, PriorityLow}
+	for k := range expected {
+		if order[k] != expected[k] {
+			t.Fatalf("expected order %v,got %v", expected, order)
+		}
+	}
+}
+
+func TestTaskKey(t *testing.T) {
+	p := NewPool(WithExecInterval(0), WithEntryCap(100), WithWorkerCap(8))
+	go p.RunContext(context.Background())
+	defer p.ShutdownContext(context.Background())
+
+	var running [2]int32
+	var mu sync.Mutex
+	seq := make(map[string][]int)
+	futures := make([]*Future, 0, 100)
+	for i := 0; i < 100; i++ {
+		i := i
+		key := "user:" + strconv.Itoa(i%2)
+		futures = append(futures, p.AddTask(NewTask(func() error {
+			if atomic.AddInt32(&running[i%2], 1) != 1 {
+				return errors.New("tasks with the same key run in parallel")
+			}
+			defer atomic.AddInt32(&running[i%2], -1)
+
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			seq[key] = append(seq[key], i)
+			mu.Unlock()
+			return nil
+		}, WithKey(key))))
+	}
+
+	for _, f := range futures {
+		if err := f.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for key, ids := range seq {
+		for k := 1; k < len(ids); k++ {
+			if ids[k] < ids[k-1] {
+				t.Fatalf("tasks of key %s run out of order: %v", key, ids)
+			}
+		}
+	}
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	fn := func() error { return nil }
+
+	// the pool is not running,so the entry chan is full after 2 tasks added.
+	p := NewPool(WithEntryCap(2))
+	p.AddTask(NewTask(fn))
+	if _, err := p.TryAddTask(NewTask(fn)); err != nil {
+		t.Fatalf("try add task error: %v", err)
+	}
+
+	if _, err := p.TryAddTask(NewTask(fn)); err != ErrPoolFull {
+		t.Fatalf("expected %v,got: %v", ErrPoolFull, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.AddTaskContext(ctx, NewTask(fn)); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v,got: %v", context.DeadlineExceeded, err)
+	}
+
+	p = NewPool(WithEntryCap(1), WithOverflowPolicy(OverflowReject))
+	p.AddTask(NewTask(fn))
+	if err := p.AddTask(NewTask(fn)).Wait(context.Background()); err != ErrPoolFull {
+		t.Fatalf("expected %v,got: %v", ErrPoolFull, err)
+	}
+
+	p = NewPool(WithEntryCap(1), WithOverflowPolicy(OverflowDropOldest))
+	oldest := p.AddTask(NewTask(fn))
+	p.AddTask(NewTask(fn))
+	if err := oldest.Wait(context.Background()); err != ErrTaskDropped {
+		t.Fatalf("expected %v,got: %v", ErrTaskDropped, err)
+	}
+
+	// the task dropped by the overflow policy is not counted by shutdown.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if res, _ := p.ShutdownContext(ctx); res.Dropped != 1 || p.Stats().Dropped != 2 {
+		t.Fatalf("unexpected shutdown result: %+v,stats dropped: %d", res, p.Stats().Dropped)
+	}
+
+	p = NewPool(WithEntryCap(1), WithOverflowPolicy(OverflowCallerRuns))
+	p.AddTask(NewTask(fn))
+	f := p.AddTask(NewTask(fn))
+	select {
+	case <-f.Done():
+	default:
+		t.Fatal("expected the task run in caller goroutine")
+	}
+
+	if res := f.Result(); res.Err != nil || res.WorkerID != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p.ShutdownContext(ctx)
+	if _, err := p.TryAddTask(NewTask(fn)); err != ErrPoolClosed {
+		t.Fatalf("expected %v,got: %v", ErrPoolClosed, err)
+	}
+}
+
+func TestTaskRetry(t *testing.T) {
+	p := NewPool(WithExecInterval(0), WithWorkerCap(2))
+	go p.RunContext(context.Background())
+	defer p.ShutdownContext(context.Background())
+
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, Jitter: 0.5}
+	errTemp := errors.New("temporary error")
+
+	var cnt int32
+	f := p.AddTask(NewTask(func() error {
+		if atomic.AddInt32(&cnt, 1) < 3 {
+			return errTemp
+		}
+
+		return nil
+	}, WithRetry(policy)))
+	if err := f.Wait(context.Background()); err != nil || f.Result().Attempts != 3 {
+		t.Fatalf("unexpected result: %+v", f.Result())
+	}
+
+	var deadErr error
+	deadLetter := make(chan struct{})
+	f = p.AddTask(NewTask(func() error {
+		return errTemp
+	}, WithRetry(policy), WithDeadLetter(func(task *Task, err error) {
+		deadErr = err
+		close(deadLetter)
+	})))
+	if err := f.Wait(context.Background()); err != errTemp || f.Result().Attempts != 4 {
+		t.Fatalf("unexpected result: %+v", f.Result())
+	}
+
+	<-deadLetter
+	if deadErr != errTemp {
+		t.Fatalf("expected dead letter error %v,got: %v", errTemp, deadErr)
+	}
+
+	f = p.AddTask(NewTaskContext(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTaskTimeout(10*time.Millisecond), WithRetry(RetryPolicy{
+		MaxRetries: 3,
+		RetryIf: func(err error) bool {
+			return err != context.DeadlineExceeded
+		},
+	})))
+	if err := f.Wait(context.Background()); err != context.DeadlineExceeded || f.Result().Attempts != 1 {
+		t.Fatalf("unexpected result: %+v", f.Result())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	r := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for n, expected := range map[int]time.Duration{1: 10, 2: 20, 3: 40, 4: 50, 100: 50} {
+		if d := r.backoff(n); d != expected*time.Millisecond {
+			t.Fatalf("expected backoff %v of retry %d,got: %v", expected*time.Millisecond, n, d)
+		}
+	}
+
+	r = RetryPolicy{BaseDelay: time.Second}
+	if d := r.backoff(1000); d <= 0 {
+		t.Fatalf("unexpected backoff: %v", d)
+	}
+}
+
+func TestStats(t *testing.T) {
+	p := NewPool(WithExecInterval(0), WithEntryCap(10), WithWorkerCap(2))
+	go p.RunContext(context.Background())
+	defer p.ShutdownContext(context.Background())
+
+	futures := p.BatchAddTask([]*Task{
+		NewTask(func() error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}),
+		NewTask(func() error {
+			return errors.New("task error")
+		}),
+		NewTask(func() error {
+			panic("task panic")
+		}),
+	})
+	for _, f := range futures {
+		f.Wait(context.Background())
+	}
+
+	stats := p.Stats()
+	if stats.Completed != 3 || stats.Failed != 1 || stats.Panicked != 1 || stats.Workers != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if stats.AvgRunTime <= 0 || stats.P99RunTime < 10*time.Millisecond {
+		t.Fatalf("unexpected run time stats: %+v", stats)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewCollector(p, "test"))
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics error: %v", err)
+	}
+
+	for _, mf := range mfs {
+		if mf.GetName() == "workpool_tasks_completed_total" {
+			if v := mf.GetMetric()[0].GetCounter().GetValue(); v != 3 {
+				t.Fatalf("expected completed 3,got: %v", v)
+			}
+
+			return
+		}
+	}
+
+	t.Fatal("workpool_tasks_completed_total not found")
+}
+
+func TestRateLimit(t *testing.T) {
+	p := NewPool(WithEntryCap(100), WithWorkerCap(10), WithRateLimit(100, 1), WithKeyRateLimit(50, 1))
+	go p.RunContext(context.Background())
+	defer p.ShutdownContext(context.Background())
+
+	fn := func() error { return nil }
+	begin := time.Now()
+	futures := make([]*Future, 0, 21)
+	for i := 0; i < 21; i++ {
+		futures = append(futures, p.AddTask(NewTask(fn)))
+	}
+
+	for _, f := range futures {
+		f.Wait(context.Background())
+	}
+
+	// the first task takes the burst token.
+	if cost := time.Since(begin); cost < 190*time.Millisecond {
+		t.Fatalf("expected cost >= 200ms,got: %v", cost)
+	}
+
+	begin = time.Now()
+	futures = futures[:0]
+	for i := 0; i < 6; i++ {
+		futures = append(futures, p.AddTask(NewTask(fn, WithKey("user"))))
+	}
+
+	for _, f := range futures {
+		f.Wait(context.Background())
+	}
+
+	if cost := time.Since(begin); cost < 90*time.Millisecond {
+		t.Fatalf("expected cost >= 100ms,got: %v", cost)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if newLimiter(0, 1) != nil {
+		t.Fatal("expected nil limiter when rate is 0")
+	}
+
+	now := time.Now()
+	l := newLimiter(10, 2)
+	for k, expected := range []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if d := l.reserve(now); d < expected-time.Millisecond || d > expected+time.Millisecond {
+			t.Fatalf("expected reserve %d wait %v,got: %v", k, expected, d)
+		}
+	}
+
+	if d := l.reserve(now.Add(time.Second)); d != 0 {
+		t.Fatalf("expected no wait after tokens refilled,got: %v", d)
+	}
+}
+
 /**
 go test -v  -test.run TestPool
 2020/07/04 11:33:01 i =  937710
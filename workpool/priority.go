@@ -0,0 +1,137 @@
+package workpool
+
+// Priority task priority.
+type Priority int
+
+const (
+	// PriorityNormal normal priority,it is the default priority of task.
+	PriorityNormal Priority = iota
+
+	// PriorityHigh high priority,the task is executed before normal and low tasks.
+	PriorityHigh
+
+	// PriorityLow low priority,the task is executed after high and normal tasks.
+	PriorityLow
+
+	// priorityNum number of priority lanes.
+	priorityNum
+)
+
+var (
+	// laneOrder poll order of priority lanes.
+	laneOrder = [priorityNum]Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+	// defaultStarvationLimit default starvation limit.
+	defaultStarvationLimit = 10
+)
+
+// WithPriority change task priority,default PriorityNormal.
+// The priority takes effect on the tasks waiting in entry chan,
+// the tasks moved to job chan keep FIFO order,so use a small job cap
+// if the high priority tasks must be executed as soon as possible.
+func WithPriority(priority Priority) TaskOption {
+	return func(t *Task) {
+		if priority < 0 || priority >= priorityNum {
+			priority = PriorityNormal
+		}
+
+		t.priority = priority
+	}
+}
+
+// WithKey set the ordering key of task,
+// the tasks with the same key run one by one in the order they are added,
+// while the tasks with different keys run in parallel.
+func WithKey(key string) TaskOption {
+	return func(t *Task) {
+		t.key = key
+	}
+}
+
+// WithStarvationLimit change starvation limit,default 10.
+// Every n polls the normal or low priority lane is polled first,
+// so the lower priority tasks are not starved by the higher priority tasks.
+// If n <= 0,the lanes are always polled by priority.
+func WithStarvationLimit(n int) Option {
+	return func(p *Pool) {
+		p.starvationLimit = n
+	}
+}
+
+// nextJob get a job from lanes,it blocks until a job is got or the pool stopped.
+func (p *Pool) nextJob() (*job, bool) {
+	if j := p.pollJob(); j != nil {
+		return j, true
+	}
+
+	select {
+	case j := <-p.lanes[PriorityHigh]:
+		return j, true
+	case j := <-p.lanes[PriorityNormal]:
+		return j, true
+	case j := <-p.lanes[PriorityLow]:
+		return j, true
+	case <-p.stop:
+		return nil, false
+	}
+}
+
+// pollJob get a job from lanes by priority without blocking,it returns nil if no job.
+func (p *Pool) pollJob() *job {
+	p.polled++
+
+	start := 0
+	if p.starvationLimit > 0 && p.polled%p.starvationLimit == 0 {
+		// poll normal and low priority lane first in turn.
+		start = 1 + (p.polled/p.starvationLimit)%2
+	}
+
+	for i := range laneOrder {
+		select {
+		case j := <-p.lanes[laneOrder[(start+i)%len(laneOrder)]]:
+			return j
+		default:
+		}
+	}
+
+	return nil
+}
+
+// lockKey returns true if the job can run now,
+// otherwise the job is pending until the running task with the same key finished.
+func (p *Pool) lockKey(j *job) bool {
+	if j.task.key == "" {
+		return true
+	}
+
+	p.keyMu.Lock()
+	defer p.keyMu.Unlock()
+
+	if pending, ok := p.keys[j.task.key]; ok {
+		p.keys[j.task.key] = append(pending, j)
+		return false
+	}
+
+	p.keys[j.task.key] = nil
+	return true
+}
+
+// unlockKey returns the next pending job with the same key of the finished job,
+// it returns nil if no pending job.
+func (p *Pool) unlockKey(j *job) *job {
+	if j.task.key == "" {
+		return nil
+	}
+
+	p.keyMu.Lock()
+	defer p.keyMu.Unlock()
+
+	pending := p.keys[j.task.key]
+	if len(pending) == 0 {
+		delete(p.keys, j.task.key)
+		return nil
+	}
+
+	p.keys[j.task.key] = pending[1:]
+	return pending[0]
+}
@@ -0,0 +1,155 @@
+package workpool
+
+import (
+	"time"
+)
+
+// defaultIdleTimeout default idle timeout of workers when autoscaling is enabled.
+var defaultIdleTimeout = 60 * time.Second
+
+// WithMinWorkers change min worker num,the pool scales workers between
+// min and max worker num when min worker num is less than max worker num.
+// Idle workers exit after idle timeout until the worker num reaches min worker num.
+func WithMinWorkers(n int) Option {
+	return func(p *Pool) {
+		p.minWorker = n
+	}
+}
+
+// WithMaxWorkers change max worker num,default workerCap.
+func WithMaxWorkers(n int) Option {
+	return func(p *Pool) {
+		p.maxWorker = n
+	}
+}
+
+// WithIdleTimeout change the idle time after which a worker exits
+// when the worker num is greater than min worker num,default 60s.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(p *Pool) {
+		p.idleTimeout = d
+	}
+}
+
+// WithScaleBacklog start a new worker when the job chan backlog reaches n.
+// A new worker is always started when all workers are busy.
+func WithScaleBacklog(n int) Option {
+	return func(p *Pool) {
+		p.scaleBacklog = n
+	}
+}
+
+// WithScaleLatency start a new worker when a task waits in queue longer than d.
+func WithScaleLatency(d time.Duration) Option {
+	return func(p *Pool) {
+		p.scaleLatency = d
+	}
+}
+
+// initWorkerNum init min and max worker num.
+func (p *Pool) initWorkerNum() {
+	if p.maxWorker <= 0 {
+		p.maxWorker = p.workerCap
+	}
+
+	p.maxWorker = clampWorkerNum(p.maxWorker)
+	if p.minWorker <= 0 || p.minWorker > p.maxWorker {
+		p.minWorker = p.maxWorker
+	}
+
+	p.workerCap = p.maxWorker
+	if p.minWorker < p.maxWorker && p.idleTimeout <= 0 {
+		p.idleTimeout = defaultIdleTimeout
+	}
+}
+
+// clampWorkerNum limit worker num in [1,defaultMaxWorker].
+func clampWorkerNum(n int) int {
+	if n < 1 {
+		return 1
+	}
+
+	if n >= defaultMaxWorker {
+		return defaultMaxWorker
+	}
+
+	return n
+}
+
+// Resize change the max worker num at runtime.
+// If autoscaling is disabled,the worker num is changed to n.
+// The extra workers exit after their current task finished.
+func (p *Pool) Resize(n int) {
+	n = clampWorkerNum(n)
+
+	p.workerMu.Lock()
+	defer p.workerMu.Unlock()
+
+	if p.minWorker == p.maxWorker || p.minWorker > n {
+		p.minWorker = n
+	}
+
+	p.maxWorker = n
+	p.workerCap = n
+	if !p.running || p.exited {
+		return
+	}
+
+	p.spawn(p.minWorker - p.workers)
+	for i := p.workers - p.maxWorker; i > 0; i-- {
+		select {
+		case p.retireCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Workers returns the number of running workers.
+func (p *Pool) Workers() int {
+	p.workerMu.Lock()
+	defer p.workerMu.Unlock()
+
+	return p.workers
+}
+
+// scaleUp start a new worker if the worker num is less than max worker num.
+func (p *Pool) scaleUp() {
+	p.workerMu.Lock()
+	defer p.workerMu.Unlock()
+
+	if !p.running || p.exited || p.workers >= p.maxWorker {
+		return
+	}
+
+	p.spawn(1)
+}
+
+// spawn start n workers,it must be called with workerMu locked.
+func (p *Pool) spawn(n int) {
+	for i := 0; i < n; i++ {
+		p.workers++
+		p.lastWorkerID++
+		p.workerWg.Add(1)
+		go p.exec(p.lastWorkerID)
+	}
+}
+
+// retire returns true if the worker should exit.
+// An idle worker exits when the worker num is greater than min worker num,
+// otherwise it exits when the worker num is greater than max worker num.
+func (p *Pool) retire(idle bool, force bool) bool {
+	p.workerMu.Lock()
+	defer p.workerMu.Unlock()
+
+	limit := p.maxWorker
+	if idle {
+		limit = p.minWorker
+	}
+
+	if !force && p.workers <= limit {
+		return false
+	}
+
+	p.workers--
+	return true
+}
@@ -0,0 +1,130 @@
+package workpool
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runTimeSamples number of the latest run time samples to compute p99.
+var runTimeSamples = 1024
+
+// Stats snapshot of the pool stats.
+type Stats struct {
+	EntryQueued int           // number of tasks in entry chan
+	JobQueued   int           // number of tasks in job chan
+	Workers     int           // number of running workers
+	BusyWorkers int           // number of workers running task
+	IdleWorkers int           // number of workers waiting for task
+	Completed   int64         // number of finished tasks,including failed and panicked tasks
+	Failed      int64         // number of tasks returned error
+	Panicked    int64         // number of tasks panic
+	Dropped     int64         // number of dropped tasks
+	AvgRunTime  time.Duration // average run time of finished tasks
+	P99RunTime  time.Duration // p99 run time of the latest finished tasks
+}
+
+// Stats returns the stats snapshot of the pool.
+func (p *Pool) Stats() Stats {
+	stats := Stats{
+		JobQueued:   len(p.jobChan),
+		Workers:     p.Workers(),
+		BusyWorkers: int(atomic.LoadInt64(&p.busy)),
+		Completed:   atomic.LoadInt64(&p.completed),
+		Failed:      atomic.LoadInt64(&p.failed),
+		Panicked:    atomic.LoadInt64(&p.panicked),
+		Dropped:     atomic.LoadInt64(&p.dropped),
+		P99RunTime:  p.runTimes.percentile(0.99),
+	}
+
+	for k := range p.lanes {
+		stats.EntryQueued += len(p.lanes[k])
+	}
+
+	if stats.IdleWorkers = stats.Workers - stats.BusyWorkers; stats.IdleWorkers < 0 {
+		stats.IdleWorkers = 0
+	}
+
+	if stats.Completed > 0 {
+		stats.AvgRunTime = time.Duration(atomic.LoadInt64(&p.runTime) / stats.Completed)
+	}
+
+	return stats
+}
+
+// finishJob finish the job future and record the result.
+func (p *Pool) finishJob(j *job, res Result) {
+	if res.Err != nil {
+		if _, ok := res.Err.(*PanicError); ok {
+			atomic.AddInt64(&p.panicked, 1)
+		} else {
+			atomic.AddInt64(&p.failed, 1)
+		}
+	}
+
+	d := res.EndTime.Sub(res.StartTime)
+	atomic.AddInt64(&p.runTime, int64(d))
+	p.runTimes.add(d)
+
+	// the completed num is increased at last,
+	// so the average run time does not count the unfinished task.
+	atomic.AddInt64(&p.completed, 1)
+	j.future.finish(res)
+}
+
+// durationRing ring buffer of durations.
+type durationRing struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newDurationRing(n int) *durationRing {
+	return &durationRing{
+		samples: make([]time.Duration, n),
+	}
+}
+
+// add add a duration,the oldest one is overwritten when the ring is full.
+func (r *durationRing) add(d time.Duration) {
+	r.mu.Lock()
+	r.samples[r.next] = d
+	r.next++
+	if r.next == len(r.samples) {
+		r.next = 0
+		r.full = true
+	}
+	r.mu.Unlock()
+}
+
+// percentile returns the q percentile of the durations in the ring.
+func (r *durationRing) percentile(q float64) time.Duration {
+	r.mu.Lock()
+	n := r.next
+	if r.full {
+		n = len(r.samples)
+	}
+
+	samples := make([]time.Duration, n)
+	copy(samples, r.samples[:n])
+	r.mu.Unlock()
+
+	if n == 0 {
+		return 0
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+
+	idx := int(q*float64(n)+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	} else if idx >= n {
+		idx = n - 1
+	}
+
+	return samples[idx]
+}
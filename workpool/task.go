@@ -0,0 +1,192 @@
+package workpool
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/daheige/thinkgo/grecover"
+)
+
+// Task task struct.
+type Task struct {
+	fn         func(ctx context.Context) error
+	priority   Priority                 // task priority,default PriorityNormal
+	key        string                   // tasks with the same key run one by one
+	timeout    time.Duration            // timeout of each exec
+	retry      *RetryPolicy             // retry policy when fn returns error
+	deadLetter func(t *Task, err error) // called with the final error after retries exhausted
+}
+
+// TaskOption func option to change task.
+type TaskOption func(t *Task)
+
+// RetryPolicy retry policy of the task.
+// The delay before the nth retry is BaseDelay * 2^(n-1),which is limited by MaxDelay,
+// and it is reduced by a random value in [0,Jitter*delay) to avoid retrying at the same time.
+type RetryPolicy struct {
+	MaxRetries int                  // max retry times,the task runs MaxRetries+1 times at most
+	BaseDelay  time.Duration        // delay before the first retry
+	MaxDelay   time.Duration        // max delay between retries,no limit if 0
+	Jitter     float64              // jitter factor in [0,1]
+	RetryIf    func(err error) bool // the error is retried if it returns true,all errors are retried if nil
+}
+
+// NewTask returns task,create a task entry.
+func NewTask(fn func() error, opts ...TaskOption) *Task {
+	return NewTaskContext(func(ctx context.Context) error {
+		return fn()
+	}, opts...)
+}
+
+// NewTaskContext returns a task whose fn receives a context,
+// the context is canceled when the task timeout or the pool quit.
+func NewTaskContext(fn func(ctx context.Context) error, opts ...TaskOption) *Task {
+	t := &Task{
+		fn: fn,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// WithTaskTimeout set the timeout of each exec,the context passed to fn is
+// canceled after timeout,the fn should return as soon as the context is done.
+func WithTaskTimeout(d time.Duration) TaskOption {
+	return func(t *Task) {
+		t.timeout = d
+	}
+}
+
+// WithRetry retry the task by policy when fn returns error,panic is not retried.
+func WithRetry(policy RetryPolicy) TaskOption {
+	return func(t *Task) {
+		t.retry = &policy
+	}
+}
+
+// WithDeadLetter set the dead letter func,it's called with the task and
+// its final error when the task failed after retries exhausted.
+func WithDeadLetter(fn func(t *Task, err error)) TaskOption {
+	return func(t *Task) {
+		t.deadLetter = fn
+	}
+}
+
+// run exec a task and returns the exec result.
+func (t *Task) run(ctx context.Context, workerID int, logEntry Logger) (res Result) {
+	res.WorkerID = workerID
+	res.StartTime = time.Now()
+
+	for {
+		res.Attempts++
+		res.Err = t.runOnce(ctx, logEntry)
+		if !t.shouldRetry(ctx, res.Attempts, res.Err) {
+			break
+		}
+
+		if !sleepContext(ctx, t.retry.backoff(res.Attempts)) {
+			break
+		}
+	}
+
+	res.EndTime = time.Now()
+	if res.Err != nil && t.deadLetter != nil {
+		t.callDeadLetter(res.Err, logEntry)
+	}
+
+	return
+}
+
+// runOnce exec fn once,the panic is converted to *PanicError.
+func (t *Task) runOnce(ctx context.Context, logEntry Logger) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			logEntry.Println("exec current task panic: ", e)
+			err = &PanicError{
+				Value: e,
+				Stack: grecover.CatchStack(),
+			}
+		}
+	}()
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	err = t.fn(ctx)
+	if err != nil {
+		logEntry.Println("exec task error: ", err)
+	}
+
+	return
+}
+
+// shouldRetry returns true if the task should retry after the attempts.
+func (t *Task) shouldRetry(ctx context.Context, attempts int, err error) bool {
+	if err == nil || t.retry == nil || attempts > t.retry.MaxRetries || ctx.Err() != nil {
+		return false
+	}
+
+	if _, ok := err.(*PanicError); ok {
+		return false
+	}
+
+	return t.retry.RetryIf == nil || t.retry.RetryIf(err)
+}
+
+// callDeadLetter call the dead letter func,the panic is logged.
+func (t *Task) callDeadLetter(err error, logEntry Logger) {
+	defer func() {
+		if e := recover(); e != nil {
+			logEntry.Println("exec dead letter func panic: ", e)
+		}
+	}()
+
+	t.deadLetter(t, err)
+}
+
+// backoff returns the delay before the nth retry.
+func (r *RetryPolicy) backoff(n int) time.Duration {
+	d := r.BaseDelay
+	for i := 1; i < n && d > 0; i++ {
+		if (r.MaxDelay > 0 && d >= r.MaxDelay) || d > math.MaxInt64/2 {
+			break
+		}
+
+		d *= 2
+	}
+
+	if r.MaxDelay > 0 && d > r.MaxDelay {
+		d = r.MaxDelay
+	}
+
+	if r.Jitter > 0 && d > 0 {
+		d -= time.Duration(r.Jitter * rand.Float64() * float64(d))
+	}
+
+	return d
+}
+
+// sleepContext sleep d,it returns false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}